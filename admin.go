@@ -0,0 +1,363 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadAdminToken reads the "adminToken" of config.json, the secret the bot
+// sends with every request that changes or deletes data.
+func loadAdminToken() (string, error) {
+
+	var file struct {
+		AdminToken string `json:"adminToken"`
+	}
+
+	contents, err := os.ReadFile(configFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = json.Unmarshal(contents, &file)
+	if err != nil {
+		return "", fmt.Errorf("loadAdminToken(): %w", err)
+	}
+
+	return file.AdminToken, nil
+}
+
+// requireAdmin guards the routes that change or delete data. Requests have to
+// carry the admin token as "Authorization: Bearer <token>". Without a token in
+// config.json only requests from the machine itself, where the bot runs, are
+// let through.
+func requireAdmin(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if token == "" {
+			if ip := net.ParseIP(c.RemoteIP()); ip == nil || !ip.IsLoopback() {
+				respond(c, nil, errUnauthorized("unauthorized", "Set an adminToken in config.json to change data from another machine"), nil)
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		given, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			respond(c, nil, errUnauthorized("unauthorized", "Missing or wrong admin token"), nil)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func DeleteMapHandler(c *gin.Context) {
+	mapID, err := DeleteMap(c)
+	respond(c, gin.H{"mapID": mapID, "message": fmt.Sprintf("Map %d deleted", mapID)}, err, nil)
+}
+
+func AmendMapHandler(c *gin.Context) {
+	summary, err := AmendMap(c)
+	respond(c, summary, err, func() string {
+		return fmt.Sprintf("Map %d is now %s, won by %s", summary.ID, capitalizeFirstLetterOfEachWord(summary.Name), teamDisplayName(summary.Winner))
+	})
+}
+
+func DeleteMatchHandler(c *gin.Context) {
+	matchID, err := DeleteMatch(c)
+	respond(c, gin.H{"matchID": matchID, "message": fmt.Sprintf("Match %d deleted", matchID)}, err, nil)
+}
+
+// DeleteMap removes a map and rolls its stats back out of every aggregate.
+func DeleteMap(c *gin.Context) (int, error) {
+
+	mapID, _ := strconv.Atoi(requestValue(c, "mapID"))
+
+	if mapID == 0 {
+		return 0, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	_, err := getMapSummary(mapID, db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return mapID, errNotFound("map_not_found", "Map not found")
+	}
+	if err != nil {
+		return mapID, errInternal(err, "Internal server error")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return mapID, errInternal(err, "Internal server error")
+	}
+	defer tx.Rollback()
+
+	err = deleteMap(mapID, tx)
+	if err != nil {
+		return mapID, errInternal(err, "Internal server error")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return mapID, errInternal(err, "Internal server error")
+	}
+
+	return mapID, nil
+}
+
+// AmendMap corrects the winner or the name of an uploaded map. Neither feeds
+// into the player stats, so the ingested stats are left as they are.
+func AmendMap(c *gin.Context) (MapSummary, error) {
+
+	mapID, _ := strconv.Atoi(requestValue(c, "mapID"))
+	winner := strings.ToLower(strings.ReplaceAll(requestValue(c, "winner"), "_", " "))
+	mapName := strings.ToLower(strings.ReplaceAll(requestValue(c, "map"), "_", " "))
+
+	if mapID == 0 || (winner == "" && mapName == "") {
+		return MapSummary{}, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	summary, err := getMapSummary(mapID, db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return summary, errNotFound("map_not_found", "Map not found")
+	}
+	if err != nil {
+		return summary, errInternal(err, "Internal server error")
+	}
+
+	if mapName != "" {
+		canonical, found := resolveMapName(mapName)
+		if !found {
+			return summary, errBadRequest("unknown_map", fmt.Sprintf("Unknown map %s", requestValue(c, "map")))
+		}
+		summary.Name = canonical
+	}
+
+	if winner != "" {
+		matchTeams, err := getMatchTeams(summary.MatchID, db)
+		if err != nil {
+			return summary, errInternal(err, "Internal server error")
+		}
+
+		if winner != "draw" && winner != matchTeams[0] && winner != matchTeams[1] {
+			return summary, errBadRequest("winner_not_in_match", fmt.Sprintf("%s isn't playing in this match (%s vs %s)", winner, matchTeams[0], matchTeams[1]))
+		}
+		summary.Winner = winner
+	}
+
+	var storedWinner any
+
+	if summary.Winner != "draw" {
+		storedWinner = summary.Winner
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return summary, errInternal(err, "Internal server error")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE map SET name = ?, winner = ? WHERE ID = ?", summary.Name, storedWinner, mapID)
+	if err != nil {
+		return summary, errInternal(err, "Internal server error")
+	}
+
+	err = advanceBracket(summary.MatchID, tx)
+	if err != nil {
+		return summary, errInternal(err, "Internal server error")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return summary, errInternal(err, "Internal server error")
+	}
+
+	return summary, nil
+}
+
+// DeleteMatch removes a match together with every map uploaded to it.
+func DeleteMatch(c *gin.Context) (int, error) {
+
+	matchID, _ := strconv.Atoi(requestValue(c, "matchID"))
+
+	if matchID == 0 {
+		return 0, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	_, err := getMatchTeams(matchID, db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return matchID, errNotFound("match_not_found", "Match not found")
+	}
+	if err != nil {
+		return matchID, errInternal(err, "Internal server error")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return matchID, errInternal(err, "Internal server error")
+	}
+	defer tx.Rollback()
+
+	err = deleteMatch(matchID, tx)
+	if err != nil {
+		return matchID, errInternal(err, "Internal server error")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return matchID, errInternal(err, "Internal server error")
+	}
+
+	return matchID, nil
+}
+
+func deleteMap(mapID int, db queryer) error {
+
+	var matchID int
+
+	err := db.QueryRow("SELECT gameID FROM map WHERE ID = ?", mapID).Scan(&matchID)
+	if err != nil {
+		return fmt.Errorf("deleteMap(): %w", err)
+	}
+
+	players, err := getMapPlayers(mapID, db)
+	if err != nil {
+		return err
+	}
+
+	err = deleteMapStats(mapID, db)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("DELETE FROM map WHERE ID = ?", mapID)
+	if err != nil {
+		return fmt.Errorf("deleteMap(): %w", err)
+	}
+
+	err = rebuildRosters(players, db)
+	if err != nil {
+		return err
+	}
+
+	err = refreshLeaderboards(matchID, players, db)
+	if err != nil {
+		return err
+	}
+
+	return advanceBracket(matchID, db)
+}
+
+func deleteMatch(matchID int, db queryer) error {
+
+	var mapIDs []int
+
+	teams, err := getMatchTeams(matchID, db)
+	if err != nil {
+		return fmt.Errorf("deleteMatch(): %w", err)
+	}
+
+	rows, err := db.Query("SELECT ID FROM map WHERE gameID = ?", matchID)
+	if err != nil {
+		return fmt.Errorf("deleteMatch(): %w", err)
+	}
+
+	for rows.Next() {
+		var mapID int
+		if err := rows.Scan(&mapID); err != nil {
+			rows.Close()
+			return fmt.Errorf("deleteMatch(): %w", err)
+		}
+		mapIDs = append(mapIDs, mapID)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("deleteMatch(): %w", err)
+	}
+
+	for _, mapID := range mapIDs {
+		err := deleteMap(mapID, db)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The bracket slot goes back to waiting for a match
+	var slotID int
+
+	err = db.QueryRow("SELECT ID FROM bracketSlot WHERE gameID = ?", matchID).Scan(&slotID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("deleteMatch(): %w", err)
+	}
+	if err == nil {
+		_, err = db.Exec("UPDATE bracketSlot SET gameID = NULL WHERE ID = ?", slotID)
+		if err != nil {
+			return fmt.Errorf("deleteMatch(): %w", err)
+		}
+
+		err = resolveBracketSlot(slotID, db)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec("DELETE FROM game WHERE ID = ?", matchID)
+	if err != nil {
+		return fmt.Errorf("deleteMatch(): %w", err)
+	}
+
+	// The match may have been the only one of a season for either team
+	for _, team := range teams {
+		err := updateSeasonsPlayed(team, db)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getMapSummary(mapID int, db queryer) (MapSummary, error) {
+
+	summary := MapSummary{ID: mapID}
+
+	var playedAt sql.NullString
+
+	err := db.QueryRow("SELECT gameID, name, COALESCE(winner, 'draw'), durationInSeconds, playedAt FROM map WHERE ID = ?", mapID).Scan(&summary.MatchID, &summary.Name, &summary.Winner, &summary.DurationInSeconds, &playedAt)
+	if err != nil {
+		return summary, err
+	}
+
+	summary.PlayedAt, err = parseStoredTime(playedAt)
+	if err != nil {
+		return summary, err
+	}
+
+	return summary, nil
+}
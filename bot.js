@@ -1,7 +1,5 @@
 const { EmbedBuilder, Client, GatewayIntentBits } = require('discord.js');
 const fsp = require('fs').promises;
-const fs = require('fs')
-const path = require('path');
 
 
 const client = new Client({ intents: [GatewayIntentBits.Guilds, GatewayIntentBits.GuildMessages, GatewayIntentBits.MessageContent] });
@@ -9,6 +7,9 @@ const client = new Client({ intents: [GatewayIntentBits.Guilds, GatewayIntentBit
 const configFile = "config.json";
 const token = "TOKEN";
 
+// Words !pstats and !leaderboard take as a role rather than a hero
+const roles = ["tank", "tanks", "damage", "dps", "support", "supports", "healer", "healers"];
+
 let logChannelID, pugsChannelID;
 let logChannel, pugsChannel;
 let pugsPlayers = [];
@@ -46,6 +47,13 @@ async function isUserAllowed(user) {
     return data.allowedUsers.includes(user);
 }
 
+// adminHeaders authorizes requests that change or delete data with the API's
+// admin token, if config.json has one.
+async function adminHeaders(headers = {}) {
+    const data = await readConfig();
+    return data.adminToken ? { ...headers, Authorization: `Bearer ${data.adminToken}` } : headers;
+}
+
 async function setLogChannel(channelID) {
     const data = await readConfig();
     data.logChannelID = channelID;
@@ -277,38 +285,99 @@ client.on('messageCreate', async message => {
         let parts = message.content.split(' ');
 
         if (!parts[1]) {
-            message.channel.send('```!pstats usage: <Player Name> [Hero Name]```');
+            message.channel.send('```!pstats usage: <Player Name> [Hero Name or Role]```');
             return;
         }
 
+        if (parts[2] && roles.includes(parts[2].toLowerCase())) {
+
+            const response = await fetch(`http://localhost:8080/players/${encodeURIComponent(parts[1])}/roles/${parts[2]}?format=text`);
+            const data = await response.json();
+
+            const embed = new EmbedBuilder()
+            .setTitle(parts[1] + " as " + parts[2])
+            .setColor(await getEmbedColor())
+            .setDescription(responseMessage(data) || 'No data message found');
+
+            await message.channel.send({ embeds: [embed] });
+            return;
+
+        }
+
         if (parts[2]) {
 
-            const response = await fetch(`http://localhost:8080/hStats?player=${parts[1]}&hero=${parts[2]}`);
+            const response = await fetch(`http://localhost:8080/players/${encodeURIComponent(parts[1])}/heroes/${parts[2]}?format=text`);
             const data = await response.json();
 
             const embed = new EmbedBuilder()
             .setTitle(parts[1] + " on " + parts[2])
             .setColor(await getEmbedColor())
-            .setDescription(data.message || 'No data message found');
+            .setDescription(responseMessage(data) || 'No data message found');
             
             await message.channel.send({ embeds: [embed] });
             return;
 
         }
 
-        const response = await fetch(`http://localhost:8080/pStats?player=${parts[1]}`);
+        const response = await fetch(`http://localhost:8080/players/${encodeURIComponent(parts[1])}?format=text`);
         const data = await response.json();
 
         const embed = new EmbedBuilder()
         .setTitle(parts[1])
         .setColor(await getEmbedColor())
-        .setDescription(data.message || 'No data message found');
+        .setDescription(responseMessage(data) || 'No data message found');
         
         await message.channel.send({ embeds: [embed] });
         return;
     
     }
 
+    else if (message.content.startsWith("!roster")) {
+
+        let parts = message.content.split(' ');
+
+        if (!parts[1]) {
+            message.channel.send('```!roster usage: <Team Name> [Season] -- Replace spaces with "_"```');
+            return;
+        }
+
+        const response = await fetch(`http://localhost:8080/teams/${parts[1]}/roster?season=${parts[2] || ''}&format=text`);
+        const data = await response.json();
+
+        const embed = new EmbedBuilder()
+        .setTitle(parts[1].replace('_', ' '))
+        .setColor(await getEmbedColor())
+        .setDescription(responseMessage(data) || 'No data message found');
+
+        await message.channel.send({ embeds: [embed] });
+        return;
+
+    }
+
+    else if (message.content.startsWith("!leaderboard")) {
+
+        let parts = message.content.split(' ');
+
+        if (!parts[1]) {
+            message.channel.send('```!leaderboard usage: <Stat e.g. damageDealt> [Hero Name or Role]```');
+            return;
+        }
+
+        const scope = parts[2] && roles.includes(parts[2].toLowerCase()) ? 'role' : 'hero';
+
+        const response = await fetch(`http://localhost:8080/leaderboards/${parts[1]}?${scope}=${parts[2] || ''}&format=text`);
+        const data = await response.json();
+
+        const embed = new EmbedBuilder()
+        .setTitle(parts[2] ? parts[1] + " on " + parts[2] : parts[1])
+        .setColor(await getEmbedColor())
+        .setDescription(responseMessage(data) || 'No data message found');
+
+        await message.channel.send({ embeds: [embed] });
+        return;
+
+    }
+
     else if (message.content.startsWith("!tstats")) {
 
         let parts = message.content.split(' ');
@@ -320,26 +389,26 @@ client.on('messageCreate', async message => {
 
         if (parts[2]) {
 
-            const response = await fetch(`http://localhost:8080/tmStats?team=${parts[1]}&map=${parts[2]}`);
+            const response = await fetch(`http://localhost:8080/teams/${parts[1]}/maps/${parts[2]}?format=text`);
             const data = await response.json();
 
             const embed = new EmbedBuilder()
             .setTitle(parts[1].replace('_', ' ') + " on " + parts[2].replace('_', ' '))
             .setColor(await getEmbedColor())
-            .setDescription(data.message || 'No data message found');
+            .setDescription(responseMessage(data) || 'No data message found');
             
             await message.channel.send({ embeds: [embed] });
             return;
 
         }
 
-        const response = await fetch(`http://localhost:8080/tStats?team=${parts[1]}`);
+        const response = await fetch(`http://localhost:8080/teams/${parts[1]}?format=text`);
         const data = await response.json();
 
         const embed = new EmbedBuilder()
         .setTitle(parts[1].replace('_', ' '))
         .setColor(await getEmbedColor())
-        .setDescription(data.message || 'No data message found');
+        .setDescription(responseMessage(data) || 'No data message found');
         
         await message.channel.send({ embeds: [embed] });
         return;
@@ -353,10 +422,10 @@ client.on('messageCreate', async message => {
             return;
         }
 
-        const response = await fetch(`http://localhost:8080/compareStats?player1=${parts[1]}&player2=${parts[2]}`);
+        const response = await fetch(`http://localhost:8080/comparisons?player1=${parts[1]}&player2=${parts[2]}&format=text`);
 
         const data = await response.json();
-        message.channel.send(`\`\`\`${data.message}\`\`\``);
+        message.channel.send(`\`\`\`${responseMessage(data)}\`\`\``);
     }
 
         // Check if the message starts with !uploadMap
@@ -383,22 +452,17 @@ client.on('messageCreate', async message => {
           message.attachments.forEach(async (attachment) => {
             if (attachment.name.endsWith('.txt')) {
               try {
-                let fileName = attachment.name;
-                const filePath = path.join(__dirname, fileName);
-                fileName = fileName.replace(".txt", "");
-      
-                // Download and save the file
-                await downloadFile(attachment.url, filePath);
-      
-                // Make the fetch request
-                const response = await fetch(`http://localhost:8080/uploadMap?matchID=${matchID}&winner=${winner}&map=${mapName}&fileName=${fileName}`);
-                if (!response.ok) {
-                  message.channel.send('Internal Server Error');
-                  return;
-                }
+                // Download the log into memory
+                const log = await downloadFile(attachment.url);
       
+                // Upload it as the request body
+                const response = await fetch(`http://localhost:8080/matches/${matchID}/maps?winner=${winner}&map=${mapName}`, {
+                  method: 'POST',
+                  headers: await adminHeaders({ 'Content-Type': 'text/plain' }),
+                  body: log,
+                });
                 const data = await response.json();
-                message.channel.send(`${data.message}`);
+                message.channel.send(`${responseMessage(data)}`);
               } catch (error) {
                 console.error('Error:', error);
                 message.channel.send('An error occurred while processing the file.');
@@ -418,23 +482,111 @@ client.on('messageCreate', async message => {
             // Split the command arguments
             let args = message.content.split(' ');
         
-            let [command, team1, team2, grandfinals] = args;
+            let [command, team1, team2, grandfinals, bestOf] = args;
         
             try {
               // Make the fetch request
-              const response = await fetch(`http://localhost:8080/createMatch?team1=${team1}&team2=${team2}&grandfinals=${grandfinals}`);
-              if (!response.ok) {
-                throw new Error(`Network response was not ok: ${response.statusText}`);
-              }
-        
+              const response = await fetch(`http://localhost:8080/matches?team1=${team1}&team2=${team2}&grandfinals=${grandfinals}&bestOf=${bestOf || ''}`, { method: 'POST', headers: await adminHeaders() });
               const data = await response.json();
-              message.channel.send(`${data.message}`);
+              message.channel.send(`${responseMessage(data)}`);
             } catch (error) {
               console.error('Error:', error);
               message.channel.send('An error occurred while creating the match.');
             }
         }
 
+        else if (message.content.startsWith('!deleteMap') || message.content.startsWith('!deleteMatch')) {
+            if (!await isUserAllowed(message.author.id)) {
+                return message.channel.send('You are not authorized to use this command.');
+            }
+
+            let [command, id] = message.content.split(' ');
+            let resource = command === '!deleteMap' ? 'maps' : 'matches';
+
+            try {
+                const response = await fetch(`http://localhost:8080/${resource}/${id}`, { method: 'DELETE', headers: await adminHeaders() });
+                const data = await response.json();
+                message.channel.send(`${responseMessage(data)}`);
+            } catch (error) {
+                console.error('Error:', error);
+                message.channel.send('An error occurred while deleting.');
+            }
+        }
+
+        else if (message.content.startsWith('!amendMap')) {
+            if (!await isUserAllowed(message.author.id)) {
+                return message.channel.send('You are not authorized to use this command.');
+            }
+
+            let [command, mapID, winner, mapName] = message.content.split(' ');
+
+            try {
+                const response = await fetch(`http://localhost:8080/maps/${mapID}?winner=${winner && winner !== '-' ? winner : ''}&map=${mapName || ''}&format=text`, { method: 'PATCH', headers: await adminHeaders() });
+                const data = await response.json();
+                message.channel.send(`${responseMessage(data)}`);
+            } catch (error) {
+                console.error('Error:', error);
+                message.channel.send('An error occurred while amending the map.');
+            }
+        }
+
+        else if (message.content.startsWith('!alias') || message.content.startsWith('!linkDiscord')) {
+            if (!await isUserAllowed(message.author.id)) {
+                return message.channel.send('You are not authorized to use this command.');
+            }
+
+            let [command, player, value] = message.content.split(' ');
+            let request = command === '!alias'
+                ? { route: 'aliases', method: 'POST', query: `alias=${encodeURIComponent(value || '')}` }
+                : { route: 'discord', method: 'PUT', query: `discordID=${encodeURIComponent(value || '')}` };
+
+            try {
+                const response = await fetch(`http://localhost:8080/players/${encodeURIComponent(player || '')}/${request.route}?${request.query}&format=text`, { method: request.method, headers: await adminHeaders() });
+                const data = await response.json();
+                message.channel.send(`${responseMessage(data)}`);
+            } catch (error) {
+                console.error('Error:', error);
+                message.channel.send('An error occurred while updating the player.');
+            }
+        }
+
+        else if (message.content.startsWith('!renameTeam') || message.content.startsWith('!mergeTeams')) {
+            if (!await isUserAllowed(message.author.id)) {
+                return message.channel.send('You are not authorized to use this command.');
+            }
+
+            let [command, team, other] = message.content.split(' ');
+            let request = command === '!renameTeam'
+                ? { method: 'PATCH', path: '', query: `name=${encodeURIComponent(other || '')}` }
+                : { method: 'POST', path: '/merge', query: `into=${encodeURIComponent(other || '')}` };
+
+            try {
+                const response = await fetch(`http://localhost:8080/teams/${encodeURIComponent(team || '')}${request.path}?${request.query}&format=text`, { method: request.method, headers: await adminHeaders() });
+                const data = await response.json();
+                message.channel.send(`${responseMessage(data)}`);
+            } catch (error) {
+                console.error('Error:', error);
+                message.channel.send('An error occurred while updating the team.');
+            }
+        }
+
+        else if (message.content.startsWith('!drawGroups')) {
+            if (!await isUserAllowed(message.author.id)) {
+                return message.channel.send('You are not authorized to use this command.');
+            }
+
+            let [command, seed] = message.content.split(' ');
+
+            try {
+                const response = await fetch(`http://localhost:8080/draws?seed=${seed || ''}&format=text`, { method: 'POST', headers: await adminHeaders() });
+                const data = await response.json();
+                message.channel.send(`${responseMessage(data)}`);
+            } catch (error) {
+                console.error('Error:', error);
+                message.channel.send('An error occurred while drawing the groups.');
+            }
+        }
+
         else if (message.content.startsWith("!updateLeaderboards")) {
             if (!await isUserAllowed(message.author.id)) {
                 return message.channel.send('You are not authorized to use this command.');
@@ -442,19 +594,29 @@ client.on('messageCreate', async message => {
             
               try {
                 // Make the fetch request
-                const response = await fetch(`http://localhost:8080/updateLeaderboards`);
-                if (!response.ok) {
-                  throw new Error(`Network response was not ok: ${response.statusText}`);
-                }
-          
+                const response = await fetch(`http://localhost:8080/leaderboards/rebuild`, { method: 'POST', headers: await adminHeaders() });
                 const data = await response.json();
-                message.channel.send(`${data.message}`);
+                message.channel.send(`${responseMessage(data)}`);
               } catch (error) {
                 console.error('Error:', error);
                 message.channel.send('An error occured updating the leaderboards.');
               }
         }
         
+        else if (message.content.startsWith('!upcoming') || message.content.startsWith('!results')) {
+            let [command, team] = message.content.split(' ');
+            let route = command === '!upcoming' ? 'schedule/upcoming' : 'results/recent';
+
+            try {
+                const response = await fetch(`http://localhost:8080/${route}?team=${team || ''}&format=text`);
+                const data = await response.json();
+                message.channel.send(`${responseMessage(data)}`);
+            } catch (error) {
+                console.error('Error:', error);
+                message.channel.send('An error occurred while fetching the schedule.');
+            }
+        }
+
         else if (message.content === '!commands' || message.content === '!help') {
 
             const bendixID = "429302329188286495";
@@ -471,7 +633,9 @@ client.on('messageCreate', async message => {
                 + '!pugs help: Lists all available pugs commands\n'
                 + '!comparestats <Player 1 OW Name> <Player 2 OW Name>: Compares two players\n'
                 + '!tstats <Team> (optional: <Map>): Returns team stats -- Spaces replaced by underscore\n'
-                + '!pstats <Player OW Name> (optional: <Hero>): Returns player stats -- Spaces replaced by underscore\n\n'
+                + '!roster <Team> (optional: <Season>): Returns who played for the team -- Spaces replaced by underscore\n'
+                + '!leaderboard <Stat> (optional: <Hero> or tank/damage/support): Returns the top 10 for a stat per 10 minutes\n'
+                + '!pstats <Player OW Name / BattleTag / @mention> (optional: <Hero> or tank/damage/support): Returns player stats -- Spaces replaced by underscore\n\n'
                 + '!rules / !rulebook\n'
                 + '!dates / !schedule\n'
                 + '!standings\n'
@@ -499,8 +663,16 @@ client.on('messageCreate', async message => {
                 + '!setEmbedColor <Hexcode without #>\n'
                 + '!updateLeaderboards\n'
                 + '!addAdmin\n\n'
-                + '!createMatch [Team1] [Team2] [0 / 1 if GF] -> spits out matchID REPLACE SPACE WITH UNDERSCORE\n'
-                + '!uploadMap [matchID] [Map] [Winner] REPLACE SPACE WITH UNDERSCORE'
+                + '!createMatch [Team1] [Team2] [0 / 1 if GF] [Best of, 3 if left out] -> spits out matchID REPLACE SPACE WITH UNDERSCORE\n'
+                + '!uploadMap [matchID] [Map] [Winner] REPLACE SPACE WITH UNDERSCORE\n'
+                + '!amendMap [mapID] [Winner] [Map] -> use - to keep the winner\n'
+                + '!deleteMap [mapID]\n'
+                + '!deleteMatch [matchID]\n'
+                + '!alias [Player] [Other name or BattleTag] -> merges the other name into the player\n'
+                + '!linkDiscord [Player] [@user]\n'
+                + '!renameTeam [Team] [New_Name] -> capitals in the new name are kept for display\n'
+                + '!mergeTeams [Team] [Into Team] -> for teams created twice by a typo\n'
+                + '!drawGroups [seed] -> draws the seeded pots into the divisions'
                 )
                 message.channel.send({embeds: [embed]});
         }
@@ -580,23 +752,20 @@ client.on('messageCreate', async message => {
 
 
 
-function downloadFile(url, filePath) {
-    return new Promise((resolve, reject) => {
-      const mod = url.startsWith('https') ? require('https') : require('http');
-      mod.get(url, (response) => {
-        if (response.statusCode === 200) {
-          const file = fs.createWriteStream(filePath);
-          response.pipe(file);
-          file.on('finish', () => {
-            file.close(() => resolve());
-          });
-        } else {
-          reject(new Error(`Failed to download file. Status code: ${response.statusCode}`));
-        }
-      }).on('error', (err) => {
-        reject(new Error(`Error downloading file: ${err.message}`));
-      });
-    });
+// The stats server reports failures as { error: { status, code, message } }
+function responseMessage(data) {
+    if (data.error) {
+        return data.error.message;
+    }
+    return data.message;
+}
+
+async function downloadFile(url) {
+    const response = await fetch(url);
+    if (!response.ok) {
+      throw new Error(`Failed to download file. Status code: ${response.status}`);
+    }
+    return response.text();
 }
 
-client.login(token);
\ No newline at end of file
+client.login(token);
@@ -0,0 +1,668 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// In bracketSlot, a NULL team hasn't been decided yet and an empty team is a
+// bye. A team facing a bye advances without playing.
+const byeTeam = ""
+
+// slotPlan is a bracket slot before it's saved. Slots are referred to by their
+// index in the plan until they have an ID.
+type slotPlan struct {
+	side         string
+	round        int
+	position     int
+	team1        *string
+	team2        *string
+	bestOf       int
+	winnerTo     int
+	winnerToTeam int
+	loserTo      int
+	loserToTeam  int
+}
+
+func BracketsHandler(c *gin.Context) {
+	brackets, err := ListBrackets(c)
+	respond(c, brackets, err, nil)
+}
+
+func BracketHandler(c *gin.Context) {
+	bracket, err := GetBracket(c)
+	respond(c, bracket, err, func() string { return formatBracketMessage(bracket) })
+}
+
+func CreateBracketHandler(c *gin.Context) {
+	bracket, err := CreateBracket(c)
+	respond(c, bracket, err, func() string { return formatBracketMessage(bracket) })
+}
+
+func ListBrackets(c *gin.Context) ([]Bracket, error) {
+
+	var brackets []Bracket
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	season, err := requestedSeason(c, db)
+	if err != nil {
+		return brackets, err
+	}
+
+	rows, err := db.Query("SELECT ID, name, format, bestOf, finalBestOf, seasonID FROM bracket WHERE seasonID = ? ORDER BY ID", season)
+	if err != nil {
+		return brackets, errInternal(err, "Internal server error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bracket Bracket
+		if err := rows.Scan(&bracket.ID, &bracket.Name, &bracket.Format, &bracket.BestOf, &bracket.FinalBestOf, &bracket.Season); err != nil {
+			return brackets, errInternal(err, "Internal server error")
+		}
+		brackets = append(brackets, bracket)
+	}
+
+	if err = rows.Err(); err != nil {
+		return brackets, errInternal(err, "Internal server error")
+	}
+
+	return brackets, nil
+}
+
+func GetBracket(c *gin.Context) (Bracket, error) {
+
+	bracketID, _ := strconv.Atoi(requestValue(c, "bracketID"))
+
+	if bracketID == 0 {
+		return Bracket{}, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	bracket, err := getBracket(bracketID, db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return bracket, errNotFound("bracket_not_found", "Bracket not found")
+	}
+	if err != nil {
+		return bracket, errInternal(err, "Internal server error")
+	}
+
+	return bracket, nil
+}
+
+// CreateBracket creates a single or double elimination bracket. Teams are
+// seeded in the order given by teams, or from the standings of the given
+// divisions: every division's first place, then every second place, and so on
+// for the top advance teams of each division. Missing seeds up to the next
+// power of two are byes.
+func CreateBracket(c *gin.Context) (Bracket, error) {
+
+	var (
+		bracket Bracket
+		seeds   []string
+		err     error
+	)
+
+	bracket.Name = strings.ReplaceAll(requestValue(c, "name"), "_", " ")
+	bracket.Format = strings.ToLower(requestValue(c, "format"))
+	bracket.BestOf, bracket.FinalBestOf = 3, 5
+
+	if bracket.Format == "" {
+		bracket.Format = "single"
+	}
+
+	if bracket.Name == "" {
+		return bracket, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	if bracket.Format != "single" && bracket.Format != "double" {
+		return bracket, errBadRequest("invalid_format", "Format has to be single or double")
+	}
+
+	for key, bestOf := range map[string]*int{"bestOf": &bracket.BestOf, "finalBestOf": &bracket.FinalBestOf} {
+		value := requestValue(c, key)
+		if value == "" {
+			continue
+		}
+		*bestOf, err = strconv.Atoi(value)
+		if err != nil || *bestOf <= 0 || *bestOf%2 == 0 {
+			return bracket, errBadRequest("invalid_best_of", fmt.Sprintf("%s has to be an odd number of maps", key))
+		}
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	bracket.Season, err = requestedSeason(c, db)
+	if err != nil {
+		return bracket, err
+	}
+
+	if teams := requestValue(c, "teams"); teams != "" {
+		for _, team := range strings.Split(teams, ",") {
+			team = strings.ToLower(strings.TrimSpace(strings.ReplaceAll(team, "_", " ")))
+			if team != "" {
+				seeds = append(seeds, team)
+			}
+		}
+	} else {
+		seeds, err = seedsFromStandings(requestValue(c, "divisions"), requestValue(c, "advance"), db)
+		if err != nil {
+			return bracket, err
+		}
+	}
+
+	for i, team := range seeds {
+		if findIndexInSlice(seeds[:i], team) != -1 {
+			return bracket, errBadRequest("duplicate_team", fmt.Sprintf("%s is seeded twice", team))
+		}
+		exists, err := teamExists(team, db)
+		if err != nil {
+			return bracket, errInternal(err, "Internal server error")
+		}
+		if !exists {
+			return bracket, errNotFound("team_not_found", fmt.Sprintf("Team %s not found", team))
+		}
+	}
+
+	minimum := 2
+	if bracket.Format == "double" {
+		minimum = 3
+	}
+	if len(seeds) < minimum {
+		return bracket, errBadRequest("not_enough_teams", fmt.Sprintf("A %s elimination bracket needs at least %d teams", bracket.Format, minimum))
+	}
+
+	plan := planBracket(seeds, bracket.Format, bracket.BestOf, bracket.FinalBestOf)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return bracket, errInternal(err, "Internal server error")
+	}
+	defer tx.Rollback()
+
+	bracket.ID, err = saveBracket(bracket, plan, tx)
+	if err != nil {
+		return bracket, errInternal(err, "Internal server error")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return bracket, errInternal(err, "Internal server error")
+	}
+
+	bracket, err = getBracket(bracket.ID, db)
+	if err != nil {
+		return bracket, errInternal(err, "Internal server error")
+	}
+
+	return bracket, nil
+}
+
+func seedsFromStandings(divisionList string, advanceString string, db *sql.DB) ([]string, error) {
+
+	var (
+		seeds     []string
+		standings [][]Standing
+	)
+
+	advance, _ := strconv.Atoi(advanceString)
+
+	if divisionList == "" || advance <= 0 {
+		return seeds, errBadRequest("missing_parameters", "Give either teams, or divisions and how many teams advance from each")
+	}
+
+	for _, id := range strings.Split(divisionList, ",") {
+		divisionID, err := strconv.Atoi(strings.TrimSpace(id))
+		if err != nil {
+			return seeds, errBadRequest("invalid_division", fmt.Sprintf("Invalid division %s", id))
+		}
+
+		division, err := getDivision(divisionID, db)
+		if errors.Is(err, sql.ErrNoRows) {
+			return seeds, errNotFound("division_not_found", fmt.Sprintf("Division %d not found", divisionID))
+		}
+		if err != nil {
+			return seeds, errInternal(err, "Internal server error")
+		}
+
+		divisionStandings, err := getStandings(division, tiebreakers, db)
+		if err != nil {
+			return seeds, errInternal(err, "Internal server error")
+		}
+		if len(divisionStandings) < advance {
+			return seeds, errBadRequest("not_enough_teams", fmt.Sprintf("%s only has %d teams", division.Name, len(divisionStandings)))
+		}
+
+		standings = append(standings, divisionStandings)
+	}
+
+	for rank := 0; rank < advance; rank++ {
+		for _, divisionStandings := range standings {
+			seeds = append(seeds, divisionStandings[rank].Team)
+		}
+	}
+
+	return seeds, nil
+}
+
+// seedOrder returns the seeds in bracket order for a bracket of size teams, so
+// that the first round pairs 1 against size, 2 against size-1 and so on, and
+// the top seeds can only meet in the final.
+func seedOrder(size int) []int {
+
+	order := []int{1}
+
+	for len(order) < size {
+		var next []int
+		for _, seed := range order {
+			next = append(next, seed, len(order)*2+1-seed)
+		}
+		order = next
+	}
+
+	return order
+}
+
+// planBracket lays out every slot of the bracket. The upper bracket, or the
+// only bracket in single elimination, halves each round. In double
+// elimination the lower bracket alternates between rounds where its winners
+// meet the losers dropping from the upper bracket and rounds where its
+// winners play each other. The upper and lower bracket winners meet in the
+// final.
+func planBracket(seeds []string, format string, bestOf int, finalBestOf int) []slotPlan {
+
+	var plan []slotPlan
+
+	size := 2
+	rounds := 1
+	for size < len(seeds) {
+		size *= 2
+		rounds++
+	}
+
+	team := func(seed int) *string {
+		name := byeTeam
+		if seed <= len(seeds) {
+			name = seeds[seed-1]
+		}
+		return &name
+	}
+
+	add := func(side string, round int, position int) int {
+		plan = append(plan, slotPlan{side: side, round: round, position: position, bestOf: bestOf})
+		return len(plan) - 1
+	}
+
+	upper := make([][]int, rounds+1)
+	for round := 1; round <= rounds; round++ {
+		for position := 0; position < size>>round; position++ {
+			upper[round] = append(upper[round], add("upper", round, position))
+		}
+	}
+
+	order := seedOrder(size)
+	for position, slot := range upper[1] {
+		plan[slot].team1, plan[slot].team2 = team(order[2*position]), team(order[2*position+1])
+	}
+
+	for round := 1; round < rounds; round++ {
+		for position, slot := range upper[round] {
+			plan[slot].winnerTo, plan[slot].winnerToTeam = upper[round+1][position/2], position%2+1
+		}
+	}
+
+	final := upper[rounds][0]
+
+	if format == "double" {
+
+		lower := make([][]int, 2*rounds-1)
+		for round := 1; round <= 2*rounds-2; round++ {
+			// Rounds 2k-1 and 2k have as many matches as upper round k+1
+			for position := 0; position < size>>((round+1)/2+1); position++ {
+				lower[round] = append(lower[round], add("lower", round, position))
+			}
+		}
+
+		for position, slot := range upper[1] {
+			plan[slot].loserTo, plan[slot].loserToTeam = lower[1][position/2], position%2+1
+		}
+
+		for round := 2; round <= rounds; round++ {
+			// Losers drop in reversed so teams don't meet again straight away
+			matches := len(upper[round])
+			for position, slot := range upper[round] {
+				plan[slot].loserTo, plan[slot].loserToTeam = lower[2*round-2][matches-1-position], 2
+			}
+		}
+
+		for round := 1; round < 2*rounds-2; round++ {
+			for position, slot := range lower[round] {
+				if round%2 == 1 {
+					plan[slot].winnerTo, plan[slot].winnerToTeam = lower[round+1][position], 1
+				} else {
+					plan[slot].winnerTo, plan[slot].winnerToTeam = lower[round+1][position/2], position%2+1
+				}
+			}
+		}
+
+		upperFinal := final
+		lowerFinal := lower[2*rounds-2][0]
+
+		final = add("final", 1, 0)
+		plan[upperFinal].winnerTo, plan[upperFinal].winnerToTeam = final, 1
+		plan[lowerFinal].winnerTo, plan[lowerFinal].winnerToTeam = final, 2
+	}
+
+	plan[final].side = "final"
+	plan[final].bestOf = finalBestOf
+
+	return plan
+}
+
+func saveBracket(bracket Bracket, plan []slotPlan, db queryer) (int, error) {
+
+	var (
+		bracketID int
+		slotIDs   []int
+	)
+
+	_, err := db.Exec("INSERT INTO bracket (seasonID, name, format, bestOf, finalBestOf) VALUES (?, ?, ?, ?, ?)", bracket.Season, bracket.Name, bracket.Format, bracket.BestOf, bracket.FinalBestOf)
+	if err != nil {
+		return bracketID, fmt.Errorf("saveBracket(): %w", err)
+	}
+
+	err = db.QueryRow("SELECT MAX(ID) FROM bracket").Scan(&bracketID)
+	if err != nil {
+		return bracketID, fmt.Errorf("saveBracket(): %w", err)
+	}
+
+	for _, slot := range plan {
+		var slotID int
+
+		_, err := db.Exec("INSERT INTO bracketSlot (bracketID, side, round, position, team1, team2, bestOf) VALUES (?, ?, ?, ?, ?, ?, ?)", bracketID, slot.side, slot.round, slot.position, slot.team1, slot.team2, slot.bestOf)
+		if err != nil {
+			return bracketID, fmt.Errorf("saveBracket(): %w", err)
+		}
+
+		err = db.QueryRow("SELECT MAX(ID) FROM bracketSlot").Scan(&slotID)
+		if err != nil {
+			return bracketID, fmt.Errorf("saveBracket(): %w", err)
+		}
+
+		slotIDs = append(slotIDs, slotID)
+	}
+
+	for i, slot := range plan {
+		var winnerTo, loserTo any
+
+		if slot.winnerToTeam != 0 {
+			winnerTo = slotIDs[slot.winnerTo]
+		}
+		if slot.loserToTeam != 0 {
+			loserTo = slotIDs[slot.loserTo]
+		}
+
+		_, err := db.Exec("UPDATE bracketSlot SET winnerTo = ?, winnerToTeam = ?, loserTo = ?, loserToTeam = ? WHERE ID = ?", winnerTo, slot.winnerToTeam, loserTo, slot.loserToTeam, slotIDs[i])
+		if err != nil {
+			return bracketID, fmt.Errorf("saveBracket(): %w", err)
+		}
+	}
+
+	// Teams with a bye in the first round go through straight away
+	for _, slotID := range slotIDs {
+		err := resolveBracketSlot(slotID, db)
+		if err != nil {
+			return bracketID, err
+		}
+	}
+
+	return bracketID, nil
+}
+
+func getBracket(bracketID int, db queryer) (Bracket, error) {
+
+	bracket := Bracket{ID: bracketID}
+
+	err := db.QueryRow("SELECT name, format, bestOf, finalBestOf, seasonID FROM bracket WHERE ID = ?", bracketID).Scan(&bracket.Name, &bracket.Format, &bracket.BestOf, &bracket.FinalBestOf, &bracket.Season)
+	if err != nil {
+		return bracket, err
+	}
+
+	rows, err := db.Query("SELECT ID FROM bracketSlot WHERE bracketID = ? ORDER BY CASE side WHEN 'upper' THEN 0 WHEN 'lower' THEN 1 ELSE 2 END, round, position", bracketID)
+	if err != nil {
+		return bracket, fmt.Errorf("getBracket(): %w", err)
+	}
+
+	var slotIDs []int
+
+	for rows.Next() {
+		var slotID int
+		if err := rows.Scan(&slotID); err != nil {
+			rows.Close()
+			return bracket, fmt.Errorf("getBracket(): %w", err)
+		}
+		slotIDs = append(slotIDs, slotID)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return bracket, fmt.Errorf("getBracket(): %w", err)
+	}
+
+	for _, slotID := range slotIDs {
+		slot, err := getBracketSlot(slotID, db)
+		if err != nil {
+			return bracket, err
+		}
+		bracket.Slots = append(bracket.Slots, slot)
+	}
+
+	return bracket, nil
+}
+
+func getBracketSlot(slotID int, db queryer) (BracketSlot, error) {
+
+	var (
+		slot                       BracketSlot
+		team1, team2, winner       sql.NullString
+		matchID, winnerTo, loserTo sql.NullInt64
+		winnerToTeam, loserToTeam  int
+	)
+
+	query := "SELECT ID, bracketID, side, round, position, team1, team2, bestOf, gameID, winner, winnerTo, winnerToTeam, loserTo, loserToTeam FROM bracketSlot WHERE ID = ?"
+
+	err := db.QueryRow(query, slotID).Scan(&slot.ID, &slot.BracketID, &slot.Side, &slot.Round, &slot.Position, &team1, &team2, &slot.BestOf, &matchID, &winner, &winnerTo, &winnerToTeam, &loserTo, &loserToTeam)
+	if err != nil {
+		return slot, err
+	}
+
+	slot.Team1, slot.Team2, slot.Winner = nullableTeam(team1), nullableTeam(team2), nullableTeam(winner)
+	slot.MatchID = int(matchID.Int64)
+	slot.WinnerTo, slot.WinnerToTeam = int(winnerTo.Int64), winnerToTeam
+	slot.LoserTo, slot.LoserToTeam = int(loserTo.Int64), loserToTeam
+
+	return slot, nil
+}
+
+func nullableTeam(team sql.NullString) *string {
+
+	if !team.Valid {
+		return nil
+	}
+
+	return &team.String
+}
+
+// advanceBracket updates the bracket slot a match is played in, if any, after
+// its maps changed. Winners and losers move on to their next slots as soon as
+// the series is decided.
+func advanceBracket(matchID int, db queryer) error {
+
+	var slotID int
+
+	err := db.QueryRow("SELECT ID FROM bracketSlot WHERE gameID = ?", matchID).Scan(&slotID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("advanceBracket(): %w", err)
+	}
+
+	return resolveBracketSlot(slotID, db)
+}
+
+// resolveBracketSlot works out a slot's winner from its byes or its match and
+// passes both teams on. A slot whose series isn't decided (anymore) takes its
+// teams back out of the next slots, as long as those haven't been played yet.
+func resolveBracketSlot(slotID int, db queryer) error {
+
+	var winner, loser *string
+
+	slot, err := getBracketSlot(slotID, db)
+	if err != nil {
+		return fmt.Errorf("resolveBracketSlot(): %w", err)
+	}
+
+	if slot.Team1 != nil && slot.Team2 != nil {
+
+		bye := byeTeam
+
+		switch {
+		case *slot.Team1 == byeTeam:
+			winner, loser = slot.Team2, &bye
+		case *slot.Team2 == byeTeam:
+			winner, loser = slot.Team1, &bye
+		case slot.MatchID != 0:
+			series, err := getSeries(slot.MatchID, db)
+			if err != nil {
+				return fmt.Errorf("resolveBracketSlot(): %w", err)
+			}
+
+			// A drawn series has to be played out before anyone advances
+			if series.Decided && series.Winner == *slot.Team1 {
+				winner, loser = slot.Team1, slot.Team2
+			}
+			if series.Decided && series.Winner == *slot.Team2 {
+				winner, loser = slot.Team2, slot.Team1
+			}
+		}
+	}
+
+	if sameTeam(winner, slot.Winner) {
+		return nil
+	}
+
+	_, err = db.Exec("UPDATE bracketSlot SET winner = ? WHERE ID = ?", winner, slotID)
+	if err != nil {
+		return fmt.Errorf("resolveBracketSlot(): %w", err)
+	}
+
+	for _, next := range []struct {
+		slot int
+		team int
+		name *string
+	}{{slot.WinnerTo, slot.WinnerToTeam, winner}, {slot.LoserTo, slot.LoserToTeam, loser}} {
+
+		if next.slot == 0 {
+			continue
+		}
+
+		var (
+			current sql.NullString
+			gameID  sql.NullInt64
+		)
+
+		err := db.QueryRow(fmt.Sprintf("SELECT team%d, gameID FROM bracketSlot WHERE ID = ?", next.team), next.slot).Scan(&current, &gameID)
+		if err != nil {
+			return fmt.Errorf("resolveBracketSlot(): %w", err)
+		}
+
+		// A slot with a match keeps its teams, so a result that would send
+		// someone else there has to wait until that match is deleted
+		if gameID.Valid {
+			if current.Valid && next.name != nil && current.String == *next.name {
+				continue
+			}
+			return errConflict("bracket_slot_played", fmt.Sprintf("This changes who plays in bracket slot %d, which already has match %d. Delete that match first", next.slot, gameID.Int64))
+		}
+
+		_, err = db.Exec(fmt.Sprintf("UPDATE bracketSlot SET team%d = ? WHERE ID = ?", next.team), next.name, next.slot)
+		if err != nil {
+			return fmt.Errorf("resolveBracketSlot(): %w", err)
+		}
+
+		err = resolveBracketSlot(next.slot, db)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sameTeam(team *string, other *string) bool {
+
+	if team == nil || other == nil {
+		return team == nil && other == nil
+	}
+
+	return *team == *other
+}
+
+// bracketSlotTeams returns the teams of a slot that's ready to be played.
+func bracketSlotTeams(slotID int, db queryer) (BracketSlot, error) {
+
+	slot, err := getBracketSlot(slotID, db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return slot, errNotFound("slot_not_found", "Bracket slot not found")
+	}
+	if err != nil {
+		return slot, errInternal(err, "Internal server error")
+	}
+
+	if slot.MatchID != 0 {
+		return slot, errConflict("slot_already_scheduled", fmt.Sprintf("Bracket slot %d is already match %d", slot.ID, slot.MatchID))
+	}
+
+	if slot.Team1 == nil || slot.Team2 == nil || *slot.Team1 == byeTeam || *slot.Team2 == byeTeam {
+		return slot, errConflict("slot_not_ready", fmt.Sprintf("Bracket slot %d doesn't have two teams yet", slot.ID))
+	}
+
+	return slot, nil
+}
+
+func formatBracketMessage(bracket Bracket) string {
+
+	message := fmt.Sprintf("%s (%s elimination)\n", bracket.Name, bracket.Format)
+
+	teamName := func(team *string) string {
+		if team == nil {
+			return "TBD"
+		}
+		if *team == byeTeam {
+			return "Bye"
+		}
+		return teamDisplayName(*team)
+	}
+
+	for _, slot := range bracket.Slots {
+		line := fmt.Sprintf("[%d] %s round %d: %s vs %s", slot.ID, slot.Side, slot.Round, teamName(slot.Team1), teamName(slot.Team2))
+		if slot.Winner != nil {
+			line += fmt.Sprintf(" -> %s", teamName(slot.Winner))
+		}
+		message += line + "\n"
+	}
+
+	return message
+}
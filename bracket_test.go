@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSeedOrder(t *testing.T) {
+
+	tests := []struct {
+		size int
+		want []int
+	}{
+		{1, []int{1}},
+		{2, []int{1, 2}},
+		{4, []int{1, 4, 2, 3}},
+		{8, []int{1, 8, 4, 5, 2, 7, 3, 6}},
+		{16, []int{1, 16, 8, 9, 4, 13, 5, 12, 2, 15, 7, 10, 3, 14, 6, 11}},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.size), func(t *testing.T) {
+			if got := seedOrder(test.size); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("seedOrder(%d) = %v, want %v", test.size, got, test.want)
+			}
+		})
+	}
+}
+
+// describeSlot writes a planned slot as "side round.position team1 v team2",
+// followed by where its winner and loser go as "slot.team" and its best-of.
+// Undecided teams are "?".
+func describeSlot(slot slotPlan) string {
+
+	team := func(name *string) string {
+		if name == nil {
+			return "?"
+		}
+		if *name == byeTeam {
+			return "bye"
+		}
+		return *name
+	}
+
+	description := fmt.Sprintf("%s %d.%d %s v %s", slot.side, slot.round, slot.position, team(slot.team1), team(slot.team2))
+
+	if slot.winnerToTeam != 0 {
+		description += fmt.Sprintf(" win %d.%d", slot.winnerTo, slot.winnerToTeam)
+	}
+	if slot.loserToTeam != 0 {
+		description += fmt.Sprintf(" lose %d.%d", slot.loserTo, slot.loserToTeam)
+	}
+
+	return description + fmt.Sprintf(" bo%d", slot.bestOf)
+}
+
+func TestPlanBracket(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		seeds  []string
+		format string
+		want   []string
+	}{
+		{
+			name:   "single elimination of two is only a final",
+			seeds:  []string{"a", "b"},
+			format: "single",
+			want: []string{
+				"final 1.0 a v b bo5",
+			},
+		},
+		{
+			name:   "single elimination of four",
+			seeds:  []string{"a", "b", "c", "d"},
+			format: "single",
+			want: []string{
+				"upper 1.0 a v d win 2.1 bo3",
+				"upper 1.1 b v c win 2.2 bo3",
+				"final 2.0 ? v ? bo5",
+			},
+		},
+		{
+			name:   "missing seeds are byes for the top seeds",
+			seeds:  []string{"a", "b", "c"},
+			format: "single",
+			want: []string{
+				"upper 1.0 a v bye win 2.1 bo3",
+				"upper 1.1 b v c win 2.2 bo3",
+				"final 2.0 ? v ? bo5",
+			},
+		},
+		{
+			name:   "double elimination of four",
+			seeds:  []string{"a", "b", "c", "d"},
+			format: "double",
+			want: []string{
+				"upper 1.0 a v d win 2.1 lose 3.1 bo3",
+				"upper 1.1 b v c win 2.2 lose 3.2 bo3",
+				"upper 2.0 ? v ? win 5.1 lose 4.2 bo3",
+				"lower 1.0 ? v ? win 4.1 bo3",
+				"lower 2.0 ? v ? win 5.2 bo3",
+				"final 1.0 ? v ? bo5",
+			},
+		},
+		{
+			name:   "double elimination of eight drops losers in reversed",
+			seeds:  []string{"a", "b", "c", "d", "e", "f", "g", "h"},
+			format: "double",
+			want: []string{
+				"upper 1.0 a v h win 4.1 lose 7.1 bo3",
+				"upper 1.1 d v e win 4.2 lose 7.2 bo3",
+				"upper 1.2 b v g win 5.1 lose 8.1 bo3",
+				"upper 1.3 c v f win 5.2 lose 8.2 bo3",
+				"upper 2.0 ? v ? win 6.1 lose 10.2 bo3",
+				"upper 2.1 ? v ? win 6.2 lose 9.2 bo3",
+				"upper 3.0 ? v ? win 13.1 lose 12.2 bo3",
+				"lower 1.0 ? v ? win 9.1 bo3",
+				"lower 1.1 ? v ? win 10.1 bo3",
+				"lower 2.0 ? v ? win 11.1 bo3",
+				"lower 2.1 ? v ? win 11.2 bo3",
+				"lower 3.0 ? v ? win 12.1 bo3",
+				"lower 4.0 ? v ? win 13.2 bo3",
+				"final 1.0 ? v ? bo5",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			var got []string
+
+			for _, slot := range planBracket(test.seeds, test.format, 3, 5) {
+				got = append(got, describeSlot(slot))
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("planBracket() =\n%q\nwant\n%q", got, test.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 
 	_ "github.com/mattn/go-sqlite3"
 
@@ -25,6 +26,15 @@ func ConnectToDatabase() *sql.DB {
 	return db
 }
 
+// queryer is implemented by both *sql.DB and *sql.Tx, so helpers that take one
+// can run either on their own or as part of a transaction.
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+	Prepare(query string) (*sql.Stmt, error)
+}
+
 func CreateDatabase() {
 
 	fmt.Println("Creating database")
@@ -36,19 +46,70 @@ func CreateDatabase() {
 	statement := `
     CREATE TABLE IF NOT EXISTS team (
 		name TEXT PRIMARY KEY,
-		seasonsPlayed INTEGER
+		seasonsPlayed INTEGER,
+		displayName TEXT,
+		tag TEXT,
+		logoURL TEXT
     );
 
 	CREATE TABLE IF NOT EXISTS player (
 		name TEXT PRIMARY KEY,
 		team TEXT,
+		ID INTEGER,
+		discordID TEXT,
 		FOREIGN KEY (team) REFERENCES team(name)
     );
 
+	CREATE TABLE IF NOT EXISTS rosterMembership (
+		ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		player TEXT,
+		team TEXT,
+		seasonID INTEGER,
+		joinedAt TEXT,
+		leftAt TEXT,
+		firstMapID INTEGER,
+		lastMapID INTEGER,
+		maps INTEGER,
+		FOREIGN KEY (player) REFERENCES player(name),
+		FOREIGN KEY (team) REFERENCES team(name),
+		FOREIGN KEY (seasonID) REFERENCES season(ID)
+	);
+
+	CREATE TABLE IF NOT EXISTS leaderboardEntry (
+		seasonID INTEGER,
+		stat TEXT,
+		role TEXT,
+		hero TEXT,
+		player TEXT,
+		value REAL,
+		rank INTEGER,
+		computedAt TEXT,
+		PRIMARY KEY (seasonID, stat, role, hero, player),
+		FOREIGN KEY (player) REFERENCES player(name)
+	);
+
+	CREATE TABLE IF NOT EXISTS leaderboardBuild (
+		seasonID INTEGER PRIMARY KEY,
+		config TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS playerAlias (
+		alias TEXT PRIMARY KEY,
+		player TEXT,
+		kind TEXT,
+		FOREIGN KEY (player) REFERENCES player(name)
+	);
+
+	CREATE TABLE IF NOT EXISTS season (
+		ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		name TEXT
+	);
+
 	CREATE TABLE IF NOT EXISTS division (
 		ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
 		name TEXT,
-		colorHexcode TEXT
+		colorHexcode TEXT,
+		seasonID INTEGER REFERENCES season(ID)
     );
 
 	CREATE TABLE IF NOT EXISTS teamGroup (
@@ -59,21 +120,66 @@ func CreateDatabase() {
 		FOREIGN KEY (team) REFERENCES team(name)
 	);
 
+	CREATE TABLE IF NOT EXISTS pot (
+		seasonID INTEGER,
+		pot INTEGER,
+		team TEXT,
+		PRIMARY KEY (seasonID, team),
+		FOREIGN KEY (seasonID) REFERENCES season(ID),
+		FOREIGN KEY (team) REFERENCES team(name)
+	);
+
 	CREATE TABLE IF NOT EXISTS game (
 		ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
 		team1 TEXT,
 		team2 TEXT,
 		grandfinals INTEGER,
+		seasonID INTEGER REFERENCES season(ID),
+		bestOf INTEGER,
+		scheduledAt TEXT,
 		FOREIGN KEY (team1) REFERENCES team(name),
 		FOREIGN KEY (team2) REFERENCES team(name)
 	);
 
+	CREATE TABLE IF NOT EXISTS bracket (
+		ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		seasonID INTEGER,
+		name TEXT,
+		format TEXT,
+		bestOf INTEGER,
+		finalBestOf INTEGER,
+		FOREIGN KEY (seasonID) REFERENCES season(ID)
+	);
+
+	CREATE TABLE IF NOT EXISTS bracketSlot (
+		ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		bracketID INTEGER,
+		side TEXT,
+		round INTEGER,
+		position INTEGER,
+		team1 TEXT,
+		team2 TEXT,
+		bestOf INTEGER,
+		gameID INTEGER,
+		winner TEXT,
+		winnerTo INTEGER,
+		winnerToTeam INTEGER,
+		loserTo INTEGER,
+		loserToTeam INTEGER,
+		FOREIGN KEY (bracketID) REFERENCES bracket(ID),
+		FOREIGN KEY (gameID) REFERENCES game(ID),
+		FOREIGN KEY (winnerTo) REFERENCES bracketSlot(ID),
+		FOREIGN KEY (loserTo) REFERENCES bracketSlot(ID)
+	);
+
 	CREATE TABLE IF NOT EXISTS map (
 		ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
 		gameID INTEGER,
 		name TEXT,
 		winner TEXT,
 		durationInSeconds INTEGER,
+		logHash TEXT,
+		playedAt TEXT,
 		FOREIGN KEY (gameID) REFERENCES game(ID),
 		FOREIGN KEY (winner) REFERENCES team(name)
 	);
@@ -82,6 +188,7 @@ func CreateDatabase() {
 		ID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
 		mapID INTEGER,
 		player TEXT,
+		team TEXT,
 		damageDealt REAL,
 		damageTaken REAL,
 		deaths REAL,
@@ -97,7 +204,8 @@ func CreateDatabase() {
 		FOREIGN KEY (player) REFERENCES player(name)
 	);
 
-	CREATE TABLE IF NOT EXISTS playerHero (
+	CREATE TABLE IF NOT EXISTS mapPlayerHero (
+		mapID INTEGER,
 		player TEXT,
 		hero TEXT,
 		damageDealt REAL,
@@ -111,7 +219,39 @@ func CreateDatabase() {
 		offensiveAssists REAL,
 		ultsUsed REAL,
 		durationInSeconds INTEGER,
-		PRIMARY KEY (player, Hero),
+		PRIMARY KEY (mapID, player, hero),
+		FOREIGN KEY (mapID) REFERENCES map(ID),
+		FOREIGN KEY (player) REFERENCES player(name)
+	);
+
+	CREATE TABLE IF NOT EXISTS mapRound (
+		mapID INTEGER,
+		round INTEGER,
+		startSeconds INTEGER,
+		endSeconds INTEGER,
+		setupSeconds INTEGER,
+		PRIMARY KEY (mapID, round),
+		FOREIGN KEY (mapID) REFERENCES map(ID)
+	);
+
+	CREATE TABLE IF NOT EXISTS mapTimeline (
+		mapID INTEGER,
+		player TEXT,
+		seconds INTEGER,
+		round INTEGER,
+		hero TEXT,
+		damageDealt REAL,
+		damageTaken REAL,
+		deaths REAL,
+		finalBlows REAL,
+		eliminations REAL,
+		soloKills REAL,
+		healingDealt REAL,
+		environmentalKills REAL,
+		offensiveAssists REAL,
+		ultsUsed REAL,
+		PRIMARY KEY (mapID, player, seconds),
+		FOREIGN KEY (mapID) REFERENCES map(ID),
 		FOREIGN KEY (player) REFERENCES player(name)
 	);
     `
@@ -121,4 +261,288 @@ func CreateDatabase() {
 		panic(fmt.Sprintf("%q: %s\n", err, statement))
 	}
 
+	migrateDatabase(db)
+
+	err = normalizeMapNames(db)
+	if err != nil {
+		panic(fmt.Sprintf("%q: normalizing map names\n", err))
+	}
+
+	err = normalizeHeroNames(db)
+	if err != nil {
+		panic(fmt.Sprintf("%q: normalizing hero names\n", err))
+	}
+
+	err = rebuildOutdatedLeaderboards(db)
+	if err != nil {
+		panic(fmt.Sprintf("%q: rebuilding leaderboards\n", err))
+	}
+
+	err = loadTeamDisplayNames(db)
+	if err != nil {
+		panic(fmt.Sprintf("%q: loading team names\n", err))
+	}
+
+}
+
+// migrateDatabase brings databases created by older versions up to date.
+// CREATE TABLE IF NOT EXISTS leaves existing tables alone, so columns added
+// since have to be added here as well.
+func migrateDatabase(db *sql.DB) {
+
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"map", "logHash", "TEXT"},
+		{"game", "seasonID", "INTEGER REFERENCES season(ID)"},
+		{"division", "seasonID", "INTEGER REFERENCES season(ID)"},
+		{"game", "bestOf", "INTEGER"},
+		{"game", "scheduledAt", "TEXT"},
+		{"map", "playedAt", "TEXT"},
+		{"player", "ID", "INTEGER"},
+		{"player", "discordID", "TEXT"},
+		{"mapPlayer", "team", "TEXT"},
+		{"team", "displayName", "TEXT"},
+		{"team", "tag", "TEXT"},
+		{"team", "logoURL", "TEXT"},
+	}
+
+	for _, column := range columns {
+		err := addColumnIfMissing(db, column.table, column.column, column.definition)
+		if err != nil {
+			panic(fmt.Sprintf("%q: adding %s.%s\n", err, column.table, column.column))
+		}
+	}
+
+	// Players are keyed by name, which changes when aliases are merged, so
+	// they get a separate ID that stays put
+	statement := `
+	CREATE UNIQUE INDEX IF NOT EXISTS mapLogHash ON map (logHash);
+	UPDATE player SET ID = rowid WHERE ID IS NULL;
+	CREATE UNIQUE INDEX IF NOT EXISTS playerID ON player (ID);
+	CREATE UNIQUE INDEX IF NOT EXISTS playerDiscordID ON player (discordID);
+	`
+
+	_, err := db.Exec(statement)
+	if err != nil {
+		panic(fmt.Sprintf("%q: %s\n", err, statement))
+	}
+
+	err = derivePlayerHeroFromMaps(db)
+	if err != nil {
+		panic(fmt.Sprintf("%q: deriving playerHero from mapPlayerHero\n", err))
+	}
+
+	err = assignMatchesToSeasons(db)
+	if err != nil {
+		panic(fmt.Sprintf("%q: assigning matches to seasons\n", err))
+	}
+
+	err = backfillRosters(db)
+	if err != nil {
+		panic(fmt.Sprintf("%q: building rosters\n", err))
+	}
+}
+
+// assignMatchesToSeasons puts matches and divisions created before seasons
+// existed in the first season and recounts every team's seasonsPlayed, which
+// used to be hardcoded to 1.
+func assignMatchesToSeasons(db *sql.DB) error {
+
+	var count int
+
+	err := db.QueryRow("SELECT COUNT(*) FROM game WHERE seasonID IS NULL").Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		var seasonID int
+
+		err := db.QueryRow("SELECT ID FROM season ORDER BY ID LIMIT 1").Scan(&seasonID)
+		if errors.Is(err, sql.ErrNoRows) {
+			seasonID, err = createSeason("Season 1", db)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec("UPDATE game SET seasonID = ? WHERE seasonID IS NULL", seasonID)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec("UPDATE division SET seasonID = ? WHERE seasonID IS NULL", seasonID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec("UPDATE team SET seasonsPlayed = (SELECT COUNT(DISTINCT seasonID) FROM game WHERE team1 = team.name OR team2 = team.name)")
+
+	return err
+}
+
+// backfillRosters builds the rosters of databases from before they were kept.
+// Old map rows don't say which team the player was on, so the player's team
+// is taken for every map where that team was playing.
+func backfillRosters(db *sql.DB) error {
+
+	var count int
+
+	err := db.QueryRow("SELECT COUNT(*) FROM rosterMembership").Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	_, err = db.Exec(`UPDATE mapPlayer SET team = (SELECT player.team FROM player WHERE player.name = mapPlayer.player)
+	WHERE team IS NULL AND (SELECT player.team FROM player WHERE player.name = mapPlayer.player) IN (
+		SELECT game.team1 FROM map JOIN game ON game.ID = map.gameID WHERE map.ID = mapPlayer.mapID
+		UNION SELECT game.team2 FROM map JOIN game ON game.ID = map.gameID WHERE map.ID = mapPlayer.mapID
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var players []string
+
+	rows, err := db.Query("SELECT DISTINCT player FROM mapPlayer WHERE team IS NOT NULL")
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var player string
+		if err := rows.Scan(&player); err != nil {
+			rows.Close()
+			return err
+		}
+		players = append(players, player)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = rebuildRosters(players, tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// derivePlayerHeroFromMaps replaces the playerHero table with a view over
+// mapPlayerHero. Hero totals from before per-map rows were kept can't be split
+// up by map, so whatever the per-map rows don't account for is kept as a
+// single row per player and hero without a map. Those rows count towards
+// unfiltered stats only.
+func derivePlayerHeroFromMaps(db *sql.DB) error {
+
+	var objectType string
+
+	err := db.QueryRow("SELECT type FROM sqlite_master WHERE name = 'playerHero'").Scan(&objectType)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if objectType == "table" {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec(`
+		INSERT INTO mapPlayerHero (mapID, player, hero, damageDealt, damageTaken, deaths, finalBlows, eliminations, soloKills, healingDealt, environmentalKills, offensiveAssists, ultsUsed, durationInSeconds)
+		SELECT NULL, total.player, total.hero,
+			total.damageDealt - COALESCE(perMap.damageDealt, 0),
+			total.damageTaken - COALESCE(perMap.damageTaken, 0),
+			total.deaths - COALESCE(perMap.deaths, 0),
+			total.finalBlows - COALESCE(perMap.finalBlows, 0),
+			total.eliminations - COALESCE(perMap.eliminations, 0),
+			total.soloKills - COALESCE(perMap.soloKills, 0),
+			total.healingDealt - COALESCE(perMap.healingDealt, 0),
+			total.environmentalKills - COALESCE(perMap.environmentalKills, 0),
+			total.offensiveAssists - COALESCE(perMap.offensiveAssists, 0),
+			total.ultsUsed - COALESCE(perMap.ultsUsed, 0),
+			total.durationInSeconds - COALESCE(perMap.durationInSeconds, 0)
+		FROM playerHero total
+		LEFT JOIN (
+			SELECT player, hero, SUM(damageDealt) AS damageDealt, SUM(damageTaken) AS damageTaken, SUM(deaths) AS deaths, SUM(finalBlows) AS finalBlows, SUM(eliminations) AS eliminations, SUM(soloKills) AS soloKills, SUM(healingDealt) AS healingDealt, SUM(environmentalKills) AS environmentalKills, SUM(offensiveAssists) AS offensiveAssists, SUM(ultsUsed) AS ultsUsed, SUM(durationInSeconds) AS durationInSeconds
+			FROM mapPlayerHero
+			GROUP BY player, hero
+		) perMap ON perMap.player = total.player AND perMap.hero = total.hero
+		WHERE total.durationInSeconds - COALESCE(perMap.durationInSeconds, 0) > 0
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DROP TABLE playerHero")
+		if err != nil {
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(`
+	CREATE VIEW IF NOT EXISTS playerHero AS
+	SELECT player, hero, SUM(damageDealt) AS damageDealt, SUM(damageTaken) AS damageTaken, SUM(deaths) AS deaths, SUM(finalBlows) AS finalBlows, SUM(eliminations) AS eliminations, SUM(soloKills) AS soloKills, SUM(healingDealt) AS healingDealt, SUM(environmentalKills) AS environmentalKills, SUM(offensiveAssists) AS offensiveAssists, SUM(ultsUsed) AS ultsUsed, SUM(durationInSeconds) AS durationInSeconds
+	FROM mapPlayerHero
+	GROUP BY player, hero
+	`)
+
+	return err
+}
+
+func addColumnIfMissing(db *sql.DB, table string, column string, definition string) error {
+
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid          int
+			name         string
+			columnType   string
+			notNull      int
+			defaultValue sql.NullString
+			primaryKey   int
+		)
+
+		err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey)
+		if err != nil {
+			return err
+		}
+
+		if name == column {
+			return nil
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+
+	return err
 }
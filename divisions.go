@@ -0,0 +1,422 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var hexcodePattern = regexp.MustCompile(`^[0-9a-fA-F]{6}$`)
+
+func DivisionsHandler(c *gin.Context) {
+	divisions, err := ListDivisions(c)
+	respond(c, divisions, err, nil)
+}
+
+func CreateDivisionHandler(c *gin.Context) {
+	division, err := CreateDivision(c)
+	respond(c, division, err, func() string { return fmt.Sprintf("Division %s created (ID %d)", division.Name, division.ID) })
+}
+
+func PotsHandler(c *gin.Context) {
+	pots, err := ListPots(c)
+	respond(c, pots, err, nil)
+}
+
+func SeedPotHandler(c *gin.Context) {
+	pot, err := SeedPot(c)
+	respond(c, pot, err, func() string {
+		return fmt.Sprintf("Pot %d: %s", pot.Number, strings.Join(pot.Teams, ", "))
+	})
+}
+
+func GroupDrawHandler(c *gin.Context) {
+	draw, err := DrawGroups(c)
+	respond(c, draw, err, func() string { return formatGroupDrawMessage(draw) })
+}
+
+func ListDivisions(c *gin.Context) ([]Division, error) {
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	season, err := requestedSeason(c, db)
+	if err != nil {
+		return nil, err
+	}
+
+	divisions, err := getDivisions(season, db)
+	if err != nil {
+		return divisions, errInternal(err, "Internal server error")
+	}
+
+	return divisions, nil
+}
+
+func CreateDivision(c *gin.Context) (Division, error) {
+
+	var division Division
+
+	division.Name = strings.ReplaceAll(requestValue(c, "name"), "_", " ")
+	division.ColorHexcode = strings.TrimPrefix(requestValue(c, "color"), "#")
+
+	if division.Name == "" {
+		return division, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	if division.ColorHexcode != "" && !hexcodePattern.MatchString(division.ColorHexcode) {
+		return division, errBadRequest("invalid_color", fmt.Sprintf("%s is not a hexcode", division.ColorHexcode))
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	season, err := requestedSeason(c, db)
+	if err != nil {
+		return division, err
+	}
+	division.Season = season
+
+	_, err = db.Exec("INSERT INTO division (name, colorHexcode, seasonID) VALUES (?, ?, ?)", division.Name, division.ColorHexcode, division.Season)
+	if err != nil {
+		return division, errInternal(err, "Internal server error")
+	}
+
+	err = db.QueryRow("SELECT MAX(ID) FROM division").Scan(&division.ID)
+	if err != nil {
+		return division, errInternal(err, "Internal server error")
+	}
+
+	return division, nil
+}
+
+func ListPots(c *gin.Context) ([]Pot, error) {
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	season, err := requestedSeason(c, db)
+	if err != nil {
+		return nil, err
+	}
+
+	pots, err := getPots(season, db)
+	if err != nil {
+		return pots, errInternal(err, "Internal server error")
+	}
+
+	return pots, nil
+}
+
+// SeedPot replaces the teams in one of the season's pots. Teams are given as a
+// comma separated list.
+func SeedPot(c *gin.Context) (Pot, error) {
+
+	var pot Pot
+
+	pot.Number, _ = strconv.Atoi(requestValue(c, "pot"))
+
+	for _, team := range strings.Split(requestValue(c, "teams"), ",") {
+		team = strings.ToLower(strings.TrimSpace(strings.ReplaceAll(team, "_", " ")))
+		if team == "" {
+			continue
+		}
+		if findIndexInSlice(pot.Teams, team) != -1 {
+			return pot, errBadRequest("duplicate_team", fmt.Sprintf("%s is in the pot twice", team))
+		}
+		pot.Teams = append(pot.Teams, team)
+	}
+
+	if pot.Number <= 0 || len(pot.Teams) == 0 {
+		return pot, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	season, err := requestedSeason(c, db)
+	if err != nil {
+		return pot, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return pot, errInternal(err, "Internal server error")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM pot WHERE seasonID = ? AND pot = ?", season, pot.Number)
+	if err != nil {
+		return pot, errInternal(err, "Internal server error")
+	}
+
+	for _, team := range pot.Teams {
+		var otherPot int
+
+		err := tx.QueryRow("SELECT pot FROM pot WHERE seasonID = ? AND team = ?", season, team).Scan(&otherPot)
+		if err == nil {
+			return pot, errConflict("team_already_seeded", fmt.Sprintf("%s is already in pot %d", team, otherPot))
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return pot, errInternal(err, "Internal server error")
+		}
+
+		_, err = tx.Exec("INSERT OR IGNORE INTO team (name, seasonsPlayed) VALUES (?, 0)", team)
+		if err != nil {
+			return pot, errInternal(err, "Internal server error")
+		}
+
+		_, err = tx.Exec("INSERT INTO pot (seasonID, pot, team) VALUES (?, ?, ?)", season, pot.Number, team)
+		if err != nil {
+			return pot, errInternal(err, "Internal server error")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return pot, errInternal(err, "Internal server error")
+	}
+
+	return pot, nil
+}
+
+// DrawGroups draws the season's pots into its divisions the same way groups.py
+// does: each group in turn gets one random team from every pot. The same seed
+// with the same pots and divisions always gives the same draw.
+func DrawGroups(c *gin.Context) (GroupDraw, error) {
+
+	var draw GroupDraw
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	season, err := requestedSeason(c, db)
+	if err != nil {
+		return draw, err
+	}
+	draw.Season = season
+
+	draw.Seed = time.Now().UnixNano()
+	if seed := requestValue(c, "seed"); seed != "" {
+		draw.Seed, err = strconv.ParseInt(seed, 10, 64)
+		if err != nil {
+			return draw, errBadRequest("invalid_seed", fmt.Sprintf("Invalid seed %s", seed))
+		}
+	}
+
+	draw.Divisions, err = getDivisions(season, db)
+	if err != nil {
+		return draw, errInternal(err, "Internal server error")
+	}
+
+	pots, err := getPots(season, db)
+	if err != nil {
+		return draw, errInternal(err, "Internal server error")
+	}
+
+	if len(draw.Divisions) == 0 || len(pots) == 0 {
+		return draw, errBadRequest("nothing_to_draw", "Create divisions and seed pots before drawing groups")
+	}
+
+	for _, pot := range pots {
+		if len(pot.Teams) != len(draw.Divisions) {
+			return draw, errBadRequest("pot_size_mismatch", fmt.Sprintf("Pot %d has %d teams, but there are %d groups", pot.Number, len(pot.Teams), len(draw.Divisions)))
+		}
+	}
+
+	random := rand.New(rand.NewSource(draw.Seed))
+
+	for i := range draw.Divisions {
+		draw.Divisions[i].Teams = nil
+		for j := range pots {
+			k := random.Intn(len(pots[j].Teams))
+			draw.Divisions[i].Teams = append(draw.Divisions[i].Teams, pots[j].Teams[k])
+			pots[j].Teams = append(pots[j].Teams[:k], pots[j].Teams[k+1:]...)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return draw, errInternal(err, "Internal server error")
+	}
+	defer tx.Rollback()
+
+	for _, division := range draw.Divisions {
+		_, err := tx.Exec("DELETE FROM teamGroup WHERE divisionID = ?", division.ID)
+		if err != nil {
+			return draw, errInternal(err, "Internal server error")
+		}
+
+		for _, team := range division.Teams {
+			_, err := tx.Exec("INSERT INTO teamGroup (divisionID, team) VALUES (?, ?)", division.ID, team)
+			if err != nil {
+				return draw, errInternal(err, "Internal server error")
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return draw, errInternal(err, "Internal server error")
+	}
+
+	return draw, nil
+}
+
+// requestedSeason returns the season asked for, or the current season.
+func requestedSeason(c *gin.Context, db *sql.DB) (int, error) {
+
+	season, err := seasonParam(c)
+	if err != nil {
+		return season, err
+	}
+
+	if season == 0 {
+		season, err = currentSeason(db)
+		if err != nil {
+			return season, errInternal(err, "Internal server error")
+		}
+	}
+
+	return season, nil
+}
+
+func getDivisions(season int, db queryer) ([]Division, error) {
+
+	var divisions []Division
+
+	rows, err := db.Query("SELECT ID, name, COALESCE(colorHexcode, '') FROM division WHERE seasonID = ? ORDER BY ID", season)
+	if err != nil {
+		return divisions, fmt.Errorf("getDivisions(): %w", err)
+	}
+
+	for rows.Next() {
+		division := Division{Season: season}
+		if err := rows.Scan(&division.ID, &division.Name, &division.ColorHexcode); err != nil {
+			rows.Close()
+			return divisions, fmt.Errorf("getDivisions(): %w", err)
+		}
+		divisions = append(divisions, division)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return divisions, fmt.Errorf("getDivisions(): %w", err)
+	}
+
+	for i := range divisions {
+		divisions[i].Teams, err = getDivisionTeams(divisions[i].ID, db)
+		if err != nil {
+			return divisions, err
+		}
+	}
+
+	return divisions, nil
+}
+
+func getDivisionTeams(divisionID int, db queryer) ([]string, error) {
+
+	var teams []string
+
+	rows, err := db.Query("SELECT team FROM teamGroup WHERE divisionID = ? ORDER BY rowid", divisionID)
+	if err != nil {
+		return teams, fmt.Errorf("getDivisionTeams(): %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var team string
+		if err := rows.Scan(&team); err != nil {
+			return teams, fmt.Errorf("getDivisionTeams(): %w", err)
+		}
+		teams = append(teams, team)
+	}
+
+	if err = rows.Err(); err != nil {
+		return teams, fmt.Errorf("getDivisionTeams(): %w", err)
+	}
+
+	return teams, nil
+}
+
+// getPots returns the season's pots in order, each pot's teams sorted by name
+// so a draw only depends on the seed and not on the order teams were seeded in.
+func getPots(season int, db queryer) ([]Pot, error) {
+
+	var pots []Pot
+
+	rows, err := db.Query("SELECT pot, team FROM pot WHERE seasonID = ? ORDER BY pot, team", season)
+	if err != nil {
+		return pots, fmt.Errorf("getPots(): %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			number int
+			team   string
+		)
+
+		if err := rows.Scan(&number, &team); err != nil {
+			return pots, fmt.Errorf("getPots(): %w", err)
+		}
+
+		if len(pots) == 0 || pots[len(pots)-1].Number != number {
+			pots = append(pots, Pot{Number: number})
+		}
+		pots[len(pots)-1].Teams = append(pots[len(pots)-1].Teams, team)
+	}
+
+	if err = rows.Err(); err != nil {
+		return pots, fmt.Errorf("getPots(): %w", err)
+	}
+
+	for i := range pots {
+		sort.Strings(pots[i].Teams)
+	}
+
+	return pots, nil
+}
+
+// getTeamDivision returns the division a team was drawn into in a season. 0
+// means the team's most recent season.
+func getTeamDivision(team string, season int, db *sql.DB) (Division, error) {
+
+	var division Division
+
+	query := "SELECT division.ID, division.name, COALESCE(division.colorHexcode, ''), division.seasonID FROM teamGroup JOIN division ON division.ID = teamGroup.divisionID WHERE teamGroup.team = ? AND (? = 0 OR division.seasonID = ?) ORDER BY division.seasonID DESC LIMIT 1"
+
+	err := db.QueryRow(query, team, season, season).Scan(&division.ID, &division.Name, &division.ColorHexcode, &division.Season)
+	if err != nil {
+		return division, err
+	}
+
+	return division, nil
+}
+
+func formatGroupDrawMessage(draw GroupDraw) string {
+
+	var message string
+
+	for _, division := range draw.Divisions {
+
+		var teams []string
+
+		for _, team := range division.Teams {
+			teams = append(teams, teamDisplayName(team))
+		}
+
+		message += fmt.Sprintf("%s: %s\n", division.Name, strings.Join(teams, ", "))
+	}
+
+	return message + fmt.Sprintf("\nSeed: %d", draw.Seed)
+}
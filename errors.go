@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is the error model shared by every endpoint. Status is the HTTP status
+// the error is reported with, Code is a stable machine readable identifier and
+// Message is safe to show to users. Details optionally carries structured
+// information such as validation errors. Err keeps the underlying cause for logging.
+type APIError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+	Err     error  `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func errBadRequest(code string, message string) error {
+	return &APIError{Status: http.StatusBadRequest, Code: code, Message: message}
+}
+
+// errInvalidLog reports a log that failed validation along with every line
+// that was rejected. Heroes that aren't in the catalog yet are named up front,
+// since the log itself is fine and only heroes.json needs updating.
+func errInvalidLog(err error) error {
+
+	var logErrors LogErrors
+	if errors.As(err, &logErrors) {
+		var heroes []string
+		for _, logErr := range logErrors {
+			if logErr.Hero != "" {
+				heroes = append(heroes, fmt.Sprintf("%q", logErr.Hero))
+			}
+		}
+
+		if len(heroes) == 1 {
+			return &APIError{Status: http.StatusBadRequest, Code: "unknown_hero", Message: fmt.Sprintf("Unknown hero %s, it has to be added to heroes.json before this log can be uploaded", heroes[0]), Details: logErrors}
+		}
+		if len(heroes) > 1 {
+			return &APIError{Status: http.StatusBadRequest, Code: "unknown_hero", Message: fmt.Sprintf("Unknown heroes %s, they have to be added to heroes.json before this log can be uploaded", strings.Join(heroes, ", ")), Details: logErrors}
+		}
+
+		return &APIError{Status: http.StatusBadRequest, Code: "invalid_log", Message: logErrors[0].Error(), Details: logErrors}
+	}
+
+	return &APIError{Status: http.StatusBadRequest, Code: "invalid_log", Message: "Couldn't read file", Err: err}
+}
+
+func errUnauthorized(code string, message string) error {
+	return &APIError{Status: http.StatusUnauthorized, Code: code, Message: message}
+}
+
+func errNotFound(code string, message string) error {
+	return &APIError{Status: http.StatusNotFound, Code: code, Message: message}
+}
+
+func errConflict(code string, message string) error {
+	return &APIError{Status: http.StatusConflict, Code: code, Message: message}
+}
+
+// errInternal reports an unexpected error. Helpers deeper down can still
+// reject a request with an APIError of their own, which is passed on as is.
+func errInternal(err error, message string) error {
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return err
+	}
+
+	return &APIError{Status: http.StatusInternalServerError, Code: "internal_error", Message: message, Err: err}
+}
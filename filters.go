@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StatsFilter narrows player and hero stats down to a subset of the maps a
+// player has played. The zero value matches everything, including hero totals
+// recorded before stats were kept per map.
+type StatsFilter struct {
+	Season      int    `json:"season,omitempty"`
+	MatchID     int    `json:"match,omitempty"`
+	Map         string `json:"map,omitempty"`
+	Opponent    string `json:"opponent,omitempty"`
+	GrandFinals bool   `json:"grandfinals,omitempty"`
+	LastMaps    int    `json:"last,omitempty"`
+}
+
+// statsFilter reads the optional season, match, map, opponent, grandfinals and
+// last query parameters.
+func statsFilter(c *gin.Context) (StatsFilter, error) {
+
+	var (
+		filter StatsFilter
+		err    error
+	)
+
+	filter.Season, err = seasonParam(c)
+	if err != nil {
+		return filter, err
+	}
+
+	if match := c.Query("match"); match != "" {
+		filter.MatchID, err = strconv.Atoi(match)
+		if err != nil || filter.MatchID <= 0 {
+			return filter, errBadRequest("invalid_filter", fmt.Sprintf("Invalid match %s", match))
+		}
+	}
+
+	if mapName := c.Query("map"); mapName != "" {
+		canonical, found := resolveMapName(mapName)
+		if !found {
+			return filter, errBadRequest("unknown_map", fmt.Sprintf("Unknown map %s", mapName))
+		}
+		filter.Map = canonical
+	}
+
+	filter.Opponent = strings.ToLower(strings.ReplaceAll(c.Query("opponent"), "_", " "))
+
+	grandFinals := c.Query("grandfinals")
+	filter.GrandFinals = grandFinals == "1" || grandFinals == "true"
+
+	if last := c.Query("last"); last != "" {
+		filter.LastMaps, err = strconv.Atoi(last)
+		if err != nil || filter.LastMaps <= 0 {
+			return filter, errBadRequest("invalid_filter", fmt.Sprintf("Invalid number of maps %s", last))
+		}
+	}
+
+	return filter, nil
+}
+
+// seasonParam reads the optional season query parameter. 0 means all seasons.
+func seasonParam(c *gin.Context) (int, error) {
+
+	season := c.Query("season")
+	if season == "" {
+		return 0, nil
+	}
+
+	seasonID, err := strconv.Atoi(season)
+	if err != nil || seasonID <= 0 {
+		return 0, errBadRequest("invalid_season", fmt.Sprintf("Invalid season %s", season))
+	}
+
+	return seasonID, nil
+}
+
+func (filter StatsFilter) isEmpty() bool {
+	return filter == StatsFilter{}
+}
+
+// ranked reports whether stats under the filter can be ranked. Leaderboards
+// are built for all of history and for each season, nothing narrower.
+func (filter StatsFilter) ranked() bool {
+	return filter == StatsFilter{Season: filter.Season}
+}
+
+// sql returns a condition to AND onto a query over a per-map stats table
+// (mapPlayer or mapPlayerHero) that has mapID and player columns.
+func (filter StatsFilter) sql(table string) (string, []any) {
+
+	var (
+		conditions []string
+		args       []any
+	)
+
+	if filter.isEmpty() {
+		return "", args
+	}
+
+	if filter.Season != 0 {
+		conditions = append(conditions, "game.seasonID = ?")
+		args = append(args, filter.Season)
+	}
+	if filter.MatchID != 0 {
+		conditions = append(conditions, "game.ID = ?")
+		args = append(args, filter.MatchID)
+	}
+	if filter.Map != "" {
+		conditions = append(conditions, "map.name = ?")
+		args = append(args, filter.Map)
+	}
+	if filter.Opponent != "" {
+		// Both teams of a match are in it, so it's the player's own team that
+		// decides who the opponent was
+		conditions = append(conditions, fmt.Sprintf("? IN (game.team1, game.team2) AND COALESCE((SELECT own.team FROM mapPlayer own WHERE own.mapID = map.ID AND own.player = %s.player), '') != ?", table))
+		args = append(args, filter.Opponent, filter.Opponent)
+	}
+	if filter.GrandFinals {
+		conditions = append(conditions, "game.grandfinals = 1")
+	}
+
+	where := "1 = 1"
+	if len(conditions) > 0 {
+		where = strings.Join(conditions, " AND ")
+	}
+
+	if filter.LastMaps == 0 {
+		return fmt.Sprintf(" AND %s.mapID IN (SELECT map.ID FROM map JOIN game ON game.ID = map.gameID WHERE %s)", table, where), args
+	}
+
+	// The player's last N maps among those matching the other filters
+	args = append(args, filter.LastMaps)
+
+	return fmt.Sprintf(" AND %s.mapID IN (SELECT map.ID FROM map JOIN game ON game.ID = map.gameID JOIN mapPlayer recent ON recent.mapID = map.ID WHERE recent.player = %s.player AND %s ORDER BY map.ID DESC LIMIT ?)", table, table, where), args
+}
@@ -1,802 +1,997 @@
 package main
 
 import (
-	"bufio"
 	"database/sql"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"math"
-	"os"
+	"net/http"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 )
 
-func UploadMap(c *gin.Context) string {
+// maxLogSize caps uploaded Workshop logs. A full map logs well under a megabyte.
+const maxLogSize = 10 << 20
 
-	fileName := c.Query("fileName")
-	winner := strings.ToLower(c.Query("winner"))
-	mapPlayed := strings.ToLower(c.Query("map"))
-	matchID, _ := strconv.Atoi(c.Query("matchID"))
+// statNames are the tracked stat columns, in the order used by every leaderboard and stat array.
+var statNames = []string{"damageDealt", "damageTaken", "deaths", "finalBlows", "eliminations", "soloKills", "healingDealt", "environmentalKills", "offensiveAssists", "ultsUsed"}
+
+func UploadMap(c *gin.Context) (UploadResult, error) {
+
+	var result UploadResult
+
+	winner := strings.ToLower(requestValue(c, "winner"))
+	mapPlayed := strings.ToLower(requestValue(c, "map"))
+	matchID, _ := strconv.Atoi(requestValue(c, "matchID"))
+	replace := strings.ToLower(requestValue(c, "replace"))
 
 	winner = strings.ReplaceAll(winner, "_", " ")
 	mapPlayed = strings.ReplaceAll(mapPlayed, "_", " ")
 
-	if matchID == 0 || mapPlayed == "" || winner == "" || fileName == "" {
-		return "Missing required query parameters"
+	if matchID == 0 || mapPlayed == "" || winner == "" {
+		return result, errBadRequest("missing_parameters", "Missing required query parameters")
 	}
 
-	playerStats, mapInfo, err := readFile(fileName + ".txt")
+	mapPlayed, found := resolveMapName(mapPlayed)
+	if !found {
+		return result, errBadRequest("unknown_map", fmt.Sprintf("Unknown map %s", requestValue(c, "map")))
+	}
+
+	logFile, err := uploadedLog(c)
 	if err != nil {
-		return "Couldn't read file"
+		return result, errBadRequest("missing_log", "Attach the Workshop log as the \"log\" file or the request body")
 	}
+	defer logFile.Close()
 
-	mapInfo.Name, mapInfo.Winner, mapInfo.MatchID = mapPlayed, winner, matchID
+	db := ConnectToDatabase()
+	defer db.Close()
 
-	mapID := createMap(mapInfo)
+	matchTeams, err := getMatchTeams(matchID, db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return result, errNotFound("match_not_found", "Match not found")
+	}
+	if err != nil {
+		return result, errInternal(err, "Internal server error")
+	}
 
-	response := saveStatsToDB(playerStats, mapID, mapInfo.TotalTimeInSeconds)
+	// Hash the log while it's parsed so re-uploads can be recognised
+	hash := sha256.New()
 
-	return response
-}
+	playerStats, mapInfo, err := parseLog(io.TeeReader(logFile, hash))
+	if err != nil {
+		return result, errInvalidLog(err)
+	}
 
-func CreateMatch(c *gin.Context) string {
-	var (
-		count   int
-		teams   [2]string
-		matchID int
-	)
+	err = checkMapTeams(matchTeams, winner, playerStats, db)
+	if err != nil {
+		return result, err
+	}
 
-	team1 := strings.ToLower(c.Query("team1"))
-	team2 := strings.ToLower(c.Query("team2"))
-	grandfinals, _ := strconv.Atoi(c.Query("grandfinals"))
+	playerStats, mapInfo.Timeline, err = resolveLogPlayers(playerStats, mapInfo.Timeline, db)
+	if err != nil {
+		return result, err
+	}
 
-	team1 = strings.ReplaceAll(team1, "_", " ")
-	team2 = strings.ReplaceAll(team2, "_", " ")
+	playerStats, err = assignLogTeams(matchTeams, playerStats, db)
+	if err != nil {
+		return result, err
+	}
 
-	teams[0], teams[1] = team1, team2
+	mapInfo.Name, mapInfo.Winner, mapInfo.MatchID = mapPlayed, winner, matchID
+	mapInfo.LogHash = hex.EncodeToString(hash.Sum(nil))
 
-	db := ConnectToDatabase()
-	defer db.Close()
+	replaceID, err := mapToReplace(replace, mapInfo, db)
+	if err != nil {
+		return result, err
+	}
 
-	for _, team := range teams {
-		err := db.QueryRow("SELECT COUNT(*) FROM team WHERE name = ?", team).Scan(&count)
-		if err != nil {
-			fmt.Println(err, "CreateMatch()")
-			return "Internal server error"
-		}
+	existingID, existingMatchID, err := getMapByLogHash(mapInfo.LogHash, db)
+	if err != nil {
+		return result, errInternal(err, "Internal server error")
+	}
 
-		if count == 0 {
-			sqlInsert := `INSERT INTO team (name, seasonsPlayed) VALUES (?, 1)`
-			_, err := db.Exec(sqlInsert, team)
-			if err != nil {
-				fmt.Println(err, "CreateMatch()")
-				return "Internal server error"
-			}
+	if existingID != 0 && existingID != replaceID {
+		if existingMatchID != matchID {
+			return result, errConflict("duplicate_log", fmt.Sprintf("This log was already uploaded as map %d of match %d", existingID, existingMatchID))
 		}
+		if replaceID != 0 {
+			return result, errConflict("duplicate_log", fmt.Sprintf("This log was already uploaded as map %d", existingID))
+		}
+
+		result.MapID, result.Duplicate = existingID, true
+		result.Message = fmt.Sprintf("This log was already uploaded as map %d", existingID)
+		return result, nil
 	}
 
-	sqlInsert := `INSERT INTO game (team1, team2, grandfinals) VALUES (?, ?, ?)`
-	_, err := db.Exec(sqlInsert, team1, team2, grandfinals)
+	mapID, err := ingestMap(mapInfo, playerStats, replaceID, db)
 	if err != nil {
-		fmt.Println(err, "CreateMatch()")
-		return "Internal server error"
+		return result, errInternal(err, "Internal server error")
 	}
 
-	err = db.QueryRow("SELECT MAX(ID) FROM game").Scan(&matchID)
-	if err != nil {
-		fmt.Println(err, "CreateMatch()")
-		return "Internal server error"
+	result.MapID, result.Replaced = mapID, replaceID != 0
+	result.Message = "Stats added successfully."
+	if result.Replaced {
+		result.Message = fmt.Sprintf("Stats of map %d replaced successfully.", mapID)
 	}
 
-	return fmt.Sprintf("%d", matchID)
+	return result, nil
 }
 
-func PStats(c *gin.Context) string {
-	var (
-		stats PlayerStats
-	)
-
-	stats.Name = strings.ToLower(c.Query("player"))
+// mapToReplace resolves the replace parameter of an upload. "true" replaces the
+// map previously ingested from the same log, a map ID replaces that map.
+func mapToReplace(replace string, mapInfo Map, db *sql.DB) (int, error) {
 
-	db := ConnectToDatabase()
-	defer db.Close()
+	switch replace {
+	case "", "false":
+		return 0, nil
+	case "true":
+		mapID, _, err := getMapByLogHash(mapInfo.LogHash, db)
+		if err != nil {
+			return 0, errInternal(err, "Internal server error")
+		}
+		return mapID, nil
+	}
 
-	stats, err := getPlayerStats(stats, db)
-	if err != nil {
-		return "No player stats found"
+	mapID, err := strconv.Atoi(replace)
+	if err != nil || mapID <= 0 {
+		return 0, errBadRequest("invalid_parameters", "replace has to be true or the ID of the map to replace")
 	}
 
-	stats = calcStatsP10(stats)
+	var matchID int
 
-	stats, err = getTop3Heroes(stats, db)
-	if err != nil {
-		return "An error occured while fetching most played heroes"
+	err = db.QueryRow("SELECT gameID FROM map WHERE ID = ?", mapID).Scan(&matchID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errNotFound("map_not_found", fmt.Sprintf("Map %d not found", mapID))
 	}
-
-	team, err := getPlayerTeam(stats.Name, db)
 	if err != nil {
-		return "An error occured while fetching player team"
+		return 0, errInternal(err, "Internal server error")
 	}
-	stats.Team = team
 
-	return formatPlayerStatsMessage(stats, nil)
+	if matchID != mapInfo.MatchID {
+		return 0, errConflict("wrong_match", fmt.Sprintf("Map %d belongs to match %d", mapID, matchID))
+	}
 
+	return mapID, nil
 }
 
-func CompareStats(c *gin.Context) string {
+// ingestMap saves a parsed map in one transaction, so a failed upload never
+// leaves partial stats behind. With a replaceID the stats of that map are
+// rolled back and replaced instead of creating a new map.
+func ingestMap(mapInfo Map, playerStats []PlayerStats, replaceID int, db *sql.DB) (int, error) {
 
-	var (
-		playerStats [2]PlayerStats
-	)
+	var players []string
 
-	playerStats[0].Name, playerStats[1].Name = strings.ToLower(c.Query("player1")), strings.ToLower(c.Query("player2"))
+	mapID := replaceID
 
-	db := ConnectToDatabase()
-	defer db.Close()
-
-	for i := 0; i < 2; i++ {
-
-		var stats PlayerStats
-		stats = playerStats[i]
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
-		stats, err := getPlayerStats(stats, db)
+	if replaceID != 0 {
+		players, err = getMapPlayers(replaceID, tx)
 		if err != nil {
-			return "No player stats found."
+			return 0, err
 		}
 
-		stats = calcStatsP10(stats)
-
-		stats, err = getTop3Heroes(stats, db)
+		err = deleteMapStats(replaceID, tx)
 		if err != nil {
-			return "An error occured while fetching most played heroes"
+			return 0, err
 		}
 
-		team, err := getPlayerTeam(stats.Name, db)
-		stats.Team = team
+		err = updateMap(replaceID, mapInfo, tx)
 		if err != nil {
-			return "Player not found"
+			return 0, err
+		}
+	} else {
+		mapID, err = createMap(mapInfo, tx)
+		if err != nil {
+			return 0, err
 		}
-
-		playerStats[i] = stats
-
 	}
 
-	statsDifference := playerStatsDifference(playerStats)
+	err = saveStatsToDB(playerStats, mapID, tx)
+	if err != nil {
+		return 0, err
+	}
 
-	message := formatCompareMessage(statsDifference, playerStats)
+	err = saveTimelineToDB(mapInfo.Timeline, mapID, tx)
+	if err != nil {
+		return 0, err
+	}
 
-	return message
-}
+	for _, player := range playerStats {
+		if findIndexInSlice(players, player.Name) == -1 {
+			players = append(players, player.Name)
+		}
+	}
 
-func PStatsHero(c *gin.Context) string {
+	err = rebuildRosters(players, tx)
+	if err != nil {
+		return 0, err
+	}
 
-	var (
-		stats PlayerStats
-		err   error
-	)
+	err = refreshLeaderboards(mapInfo.MatchID, players, tx)
+	if err != nil {
+		return 0, err
+	}
 
-	hero := strings.ToLower(strings.ReplaceAll(c.Query("hero"), "_", " "))
-	stats.Name = strings.ToLower(c.Query("player"))
+	err = advanceBracket(mapInfo.MatchID, tx)
+	if err != nil {
+		return 0, err
+	}
 
-	hero = handleWeirdHeroNames(hero)
+	return mapID, tx.Commit()
+}
 
-	db := ConnectToDatabase()
-	defer db.Close()
+func getMapByLogHash(logHash string, db queryer) (int, int, error) {
 
-	stats.Team, err = getPlayerTeam(stats.Name, db)
+	var mapID, matchID int
 
+	err := db.QueryRow("SELECT ID, gameID FROM map WHERE logHash = ?", logHash).Scan(&mapID, &matchID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, nil
+	}
 	if err != nil {
-		return "Player not found"
+		return 0, 0, err
 	}
 
-	stats, err = getPlayerHeroStats(stats.Name, hero, db)
+	return mapID, matchID, nil
+}
 
-	if err != nil {
-		return "No player stats found for this hero"
-	}
+// uploadedLog returns the Workshop log sent with an upload, either as the "log"
+// multipart file or as the raw request body. Logs are parsed in memory and are
+// never written to or read from disk.
+func uploadedLog(c *gin.Context) (io.ReadCloser, error) {
 
-	stats = calcStatsP10(stats)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxLogSize)
+
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		fileHeader, err := c.FormFile("log")
+		if err != nil {
+			return nil, err
+		}
+		return fileHeader.Open()
+	}
 
-	message := formatPlayerStatsMessage(stats, &hero)
+	if c.Request.ContentLength == 0 {
+		return nil, errors.New("empty request body")
+	}
 
-	return message
+	return c.Request.Body, nil
 }
 
-func TStats(c *gin.Context) string {
-
-	var teamStats TeamStats
+func CreateMatch(c *gin.Context) (int, error) {
+	var (
+		count   int
+		teams   [2]string
+		matchID int
+	)
 
-	teamStats.Team = strings.ToLower(strings.ReplaceAll(c.Query("team"), "_", " "))
+	team1 := strings.ToLower(requestValue(c, "team1"))
+	team2 := strings.ToLower(requestValue(c, "team2"))
+	grandfinals, _ := strconv.Atoi(requestValue(c, "grandfinals"))
 
-	db := ConnectToDatabase()
+	var bestOf, scheduledAt any
 
-	teamStats, err := getTeamStats(teamStats, db)
-	if err != nil {
-		return "No team stats found"
+	if scheduled := requestValue(c, "scheduledAt"); scheduled != "" {
+		value, err := parseScheduledAt(scheduled)
+		if err != nil {
+			return 0, err
+		}
+		scheduledAt = value
 	}
 
-	message := formatTeamStatsMessage(teamStats)
+	if requested := requestValue(c, "bestOf"); requested != "" {
+		value, err := strconv.Atoi(requested)
+		if err != nil || value <= 0 {
+			return 0, errBadRequest("invalid_best_of", fmt.Sprintf("Invalid best-of %s", requested))
+		}
+		bestOf = value
+	}
 
-	return message
-}
+	slotID, _ := strconv.Atoi(requestValue(c, "slot"))
 
-func TStatsMap(c *gin.Context) string {
+	team1 = strings.ReplaceAll(team1, "_", " ")
+	team2 = strings.ReplaceAll(team2, "_", " ")
 
-	var teamStats TeamStats
+	if (team1 == "" || team2 == "") && slotID == 0 {
+		return 0, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
 
-	teamStats.Team = strings.ToLower(strings.ReplaceAll(c.Query("team"), "_", " "))
-	mapName := strings.ToLower(strings.ReplaceAll(c.Query("map"), "_", " "))
+	if team1 == team2 && slotID == 0 {
+		return 0, errBadRequest("same_team", "A team can't play against itself")
+	}
 
 	db := ConnectToDatabase()
+	defer db.Close()
 
-	teamStats, err := getTeamMapStats(teamStats, mapName, db)
-	if err != nil {
-		return "No stats found"
-	}
-
-	message := formatTeamStatsMessage(teamStats)
+	// A bracket slot's match is between the teams that made it to the slot
+	if slotID != 0 {
+		slot, err := bracketSlotTeams(slotID, db)
+		if err != nil {
+			return 0, err
+		}
 
-	return message
-}
+		if team1 == "" && team2 == "" {
+			team1, team2 = *slot.Team1, *slot.Team2
+		}
 
-func UpdateLeaderboards() string {
+		if !(team1 == *slot.Team1 && team2 == *slot.Team2) && !(team1 == *slot.Team2 && team2 == *slot.Team1) {
+			return 0, errConflict("slot_teams_mismatch", fmt.Sprintf("Bracket slot %d is %s vs %s", slotID, *slot.Team1, *slot.Team2))
+		}
 
-	heroLeaderboards := calculateHeroStatLeaderboards()
-	generalLeaderboards := calculateGeneralStatLeaderboards()
+		if slot.Side == "final" {
+			grandfinals = 1
+		}
 
-	if heroLeaderboards && generalLeaderboards {
-		return "Leaderboards successfully updated"
+		if bestOf == nil {
+			bestOf = slot.BestOf
+		}
 	}
 
-	return "Error updating leaderboards"
-}
+	if bestOf == nil {
+		bestOf = defaultBestOf
+	}
 
-func getTeamMapStats(teamStats TeamStats, mapName string, db *sql.DB) (TeamStats, error) {
+	teams[0], teams[1] = team1, team2
 
-	var winner string
+	seasonID, err := matchSeason(requestValue(c, "season"), db)
+	if err != nil {
+		return 0, err
+	}
 
-	query := "SELECT map.winner FROM map JOIN game ON map.gameID = game.ID WHERE (game.team1 = ? OR game.team2 = ?) AND map.name = ?"
+	for _, team := range teams {
+		err := db.QueryRow("SELECT COUNT(*) FROM team WHERE name = ?", team).Scan(&count)
+		if err != nil {
+			return 0, errInternal(err, "Internal server error")
+		}
 
-	rows, err := db.Query(query, teamStats.Team, teamStats.Team, mapName)
+		if count == 0 {
+			sqlInsert := `INSERT INTO team (name, seasonsPlayed) VALUES (?, 0)`
+			_, err := db.Exec(sqlInsert, team)
+			if err != nil {
+				return 0, errInternal(err, "Internal server error")
+			}
+		}
+	}
 
+	sqlInsert := `INSERT INTO game (team1, team2, grandfinals, seasonID, bestOf, scheduledAt) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = db.Exec(sqlInsert, team1, team2, grandfinals, seasonID, bestOf, scheduledAt)
 	if err != nil {
-		fmt.Println(err, "getTeamMapStats()")
-		return teamStats, err
+		return 0, errInternal(err, "Internal server error")
 	}
 
-	defer rows.Close()
+	err = db.QueryRow("SELECT MAX(ID) FROM game").Scan(&matchID)
+	if err != nil {
+		return 0, errInternal(err, "Internal server error")
+	}
 
-	for rows.Next() {
-		
-		err := rows.Scan(&winner)
+	if slotID != 0 {
+		_, err = db.Exec("UPDATE bracketSlot SET gameID = ? WHERE ID = ?", matchID, slotID)
 		if err != nil {
-			fmt.Println(err, "getTeamMapStats()")
-			return teamStats, err
+			return 0, errInternal(err, "Internal server error")
 		}
+	}
 
-		if winner == "draw" {
-			teamStats.MapDraws += 1
-		} else if winner == teamStats.Team {
-			teamStats.MapWins += 1
-		} else {
-			teamStats.MapLosses += 1
+	for _, team := range teams {
+		err := updateSeasonsPlayed(team, db)
+		if err != nil {
+			return 0, errInternal(err, "Internal server error")
 		}
 	}
 
-	return teamStats, nil
-
+	return matchID, nil
 }
 
-func getTeamStats(teamStats TeamStats, db *sql.DB) (TeamStats, error) {
-
+func PStats(c *gin.Context) (PlayerStats, error) {
 	var (
-		winner  string
-		mapName string
+		stats PlayerStats
 	)
 
-	query := "SELECT map.name, map.winner FROM map JOIN game ON map.gameID = game.ID WHERE game.team1 = ? OR game.team2 = ?"
+	filter, err := statsFilter(c)
+	if err != nil {
+		return stats, err
+	}
 
-	rows, err := db.Query(query, teamStats.Team, teamStats.Team)
+	db := ConnectToDatabase()
+	defer db.Close()
 
+	stats.Name, err = lookupPlayer(requestValue(c, "player"), db)
 	if err != nil {
-		fmt.Println(err, "getTeamStats()")
-		return teamStats, err
+		return stats, err
 	}
 
-	defer rows.Close()
-
-	for rows.Next() {
+	team, err := getPlayerTeam(stats.Name, db)
+	if err != nil {
+		return stats, errInternal(err, "An error occured while fetching player team")
+	}
 
-		err := rows.Scan(&mapName, &winner)
-		if err != nil {
-			return teamStats, err
-		}
+	stats, err = getPlayerStats(stats, filter, db)
+	if err != nil {
+		return stats, errInternal(err, "An error occured while fetching player stats")
+	}
+	if stats.DurationInSeconds == 0 {
+		return stats, errNotFound("stats_not_found", "No player stats found")
+	}
 
-		found := false
-		for i := 0; i < len(teamStats.Maps); i++ {
+	stats.Team = team
 
-			if mapName != teamStats.Maps[i].Name {
-				continue
-			}
+	stats = calcStatsP10(stats)
 
-			if winner == "draw" {
-				teamStats.Maps[i].Draws += 1
-				teamStats.MapDraws += 1
-				found = true
-			} else if winner == teamStats.Team {
-				teamStats.Maps[i].Wins += 1
-				teamStats.MapWins += 1
-				found = true
-			} else {
-				teamStats.Maps[i].Losses += 1
-				teamStats.MapLosses += 1
-				found = true
-			}
+	stats, err = getTop3Heroes(stats, filter, db)
+	if err != nil {
+		return stats, errInternal(err, "An error occured while fetching most played heroes")
+	}
 
-		}
-		if !found {
+	stats.Stints, err = getPlayerStints(stats.Name, filter, db)
+	if err != nil {
+		return stats, errInternal(err, "An error occured while fetching player teams")
+	}
 
-			if winner == "draw" {
-				teamStats.Maps = append(teamStats.Maps, MapStats{Name: mapName, Draws: 1, Wins: 0, Losses: 0})
-				teamStats.MapDraws += 1
-			} else if winner == teamStats.Team {
-				teamStats.Maps = append(teamStats.Maps, MapStats{Name: mapName, Draws: 0, Wins: 1, Losses: 0})
-				teamStats.MapWins += 1
-			} else {
-				teamStats.Maps = append(teamStats.Maps, MapStats{Name: mapName, Draws: 0, Wins: 0, Losses: 1})
-				teamStats.MapLosses += 1
-			}
-		}
+	if !filter.ranked() {
+		return stats, nil
+	}
 
+	stats.Ranks, err = getPlayerRanks(stats.Name, "", "", filter.Season, db)
+	if err != nil {
+		return stats, errInternal(err, "An error occured while fetching leaderboard ranks")
 	}
 
-	return teamStats, nil
+	return stats, nil
+
 }
 
-func formatTeamStatsMessage(stats TeamStats) string {
+func CompareStats(c *gin.Context) (PlayerComparison, error) {
 
 	var (
-		mostPlayedMaps []MapStats
-		mp int
-		response string
+		comparison PlayerComparison
 	)
 
-	percent := "%"
+	playerStats := &comparison.Players
 
-	if len(stats.Maps) > 0 {
+	if requestValue(c, "player1") == "" || requestValue(c, "player2") == "" {
+		return comparison, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
 
-		var length int
+	filter, err := statsFilter(c)
+	if err != nil {
+		return comparison, err
+	}
 
-		if len(stats.Maps) < 3 {
-			length = len(stats.Maps)
-		} else {
-			length = 3
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+
+		var stats PlayerStats
+
+		stats.Name, err = lookupPlayer(requestValue(c, fmt.Sprintf("player%d", i+1)), db)
+		if err != nil {
+			return comparison, err
 		}
 
-		response = "Most played maps:\n"
-		for i := 0; i < length; i++ {
-			counter := 0
-			for j := 0; j < len(stats.Maps); j++ {
-				if (stats.Maps[i].Wins + stats.Maps[i].Losses + stats.Maps[i].Draws) > counter {
-					mp = i
-				}
-			}
-			mostPlayedMaps = append(mostPlayedMaps, stats.Maps[mp])
-			
+		team, err := getPlayerTeam(stats.Name, db)
+		if err != nil {
+			return comparison, errInternal(err, "An error occured while fetching player team")
+		}
 
-			wr := (float64(mostPlayedMaps[i].Wins) / float64((mostPlayedMaps[i].Wins + mostPlayedMaps[i].Losses))) * 100
+		stats, err = getPlayerStats(stats, filter, db)
+		if err != nil {
+			return comparison, errInternal(err, "An error occured while fetching player stats")
+		}
+		if stats.DurationInSeconds == 0 {
+			return comparison, errNotFound("stats_not_found", "No player stats found.")
+		}
 
-			stats.Maps[mp].Wins, stats.Maps[mp].Losses, stats.Maps[mp].Draws = 0, 0, 0
+		stats.Team = team
 
-			response += fmt.Sprintf("%s: %.2f%s W/L\n", capitalizeFirstLetterOfEachWord(mostPlayedMaps[i].Name), wr, percent)
+		stats = calcStatsP10(stats)
+
+		stats, err = getTop3Heroes(stats, filter, db)
+		if err != nil {
+			return comparison, errInternal(err, "An error occured while fetching most played heroes")
 		}
-		response += "\n"
+
+		playerStats[i] = stats
+
 	}
 
-	response += fmt.Sprintf("Map Wins: %d\nMap Losses: %d\nMap Draws: %d", stats.MapWins, stats.MapLosses, stats.MapDraws)
+	comparison.Difference = playerStatsDifference(*playerStats)
 
-	return response
-} 
+	return comparison, nil
+}
 
-func calculateHeroStatLeaderboards() bool {
+func PStatsHero(c *gin.Context) (PlayerStats, error) {
 
 	var (
-		player         string
-		heroStatMaps   [][]map[string]float64
-		heroStatArrays [][][]string
+		stats PlayerStats
+		err   error
 	)
 
-	heroes := []string{"ana", "ashe", "baptiste", "bastion", "brigitte", "cassidy", "d.va", "doomfist", "echo", "genji", "hanzo", "illari", "junker queen", "junkrat", "juno", "kiriko", "lifeweaver", "lúcio",
-		"mauga", "mei", "mercy", "moira", "orisa", "pharah", "ramattra", "reaper", "reinhardt", "roadhog", "sigma", "sojourn", "soldier: 76", "sombra", "symmetra", "torbjörn", "tracer",
-		"venture", "widowmaker", "winston", "wrecking ball", "zarya", "zenyatta"}
+	if requestValue(c, "player") == "" || requestValue(c, "hero") == "" {
+		return stats, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
 
-	db := ConnectToDatabase()
+	hero, found := resolveHeroName(requestValue(c, "hero"))
+	if !found {
+		return stats, errBadRequest("unknown_hero", fmt.Sprintf("Unknown hero %s", requestValue(c, "hero")))
+	}
 
-	for i := 0; i < len(heroes); i++ {
+	filter, err := statsFilter(c)
+	if err != nil {
+		return stats, err
+	}
 
-		var statsMap []map[string]float64
+	db := ConnectToDatabase()
+	defer db.Close()
 
-		heroStatMaps = append(heroStatMaps, statsMap)
-		heroStatMaps[i] = createDicts()
+	stats.Name, err = lookupPlayer(requestValue(c, "player"), db)
+	if err != nil {
+		return stats, err
 	}
 
-	rows, err := db.Query("SELECT name FROM player")
+	team, err := getPlayerTeam(stats.Name, db)
+	if err != nil {
+		return stats, errInternal(err, "An error occured while fetching player team")
+	}
 
+	stats, err = getPlayerHeroStats(stats.Name, hero, filter, db)
 	if err != nil {
-		fmt.Println(err, "calculateHeroStatLeaderboards")
-		return false
+		return stats, errInternal(err, "An error occured while fetching hero stats")
+	}
+	if stats.DurationInSeconds == 0 {
+		return stats, errNotFound("stats_not_found", "No player stats found for this hero")
 	}
 
-	defer rows.Close()
+	stats.Team, stats.Hero = team, hero
 
-	for rows.Next() {
+	stats = calcStatsP10(stats)
 
-		err := rows.Scan(&player)
+	if !filter.ranked() {
+		return stats, nil
+	}
 
-		if err != nil {
-			fmt.Println(err, "calculateHeroStatLeaderboards")
-			return false
-		}
+	stats.Ranks, err = getPlayerRanks(stats.Name, "", hero, filter.Season, db)
+	if err != nil {
+		return stats, errInternal(err, "An error occured while fetching leaderboard ranks")
+	}
 
-		for i := 0; i < len(heroStatMaps); i++ {
+	return stats, nil
+}
 
-			enoughHeroPlaytime := check10MinutesHeroPlaytime(player, heroes[i], db)
+// PStatsRole sums a player's stats over the heroes of a role, ranked against
+// other players of that role.
+func PStatsRole(c *gin.Context) (PlayerStats, error) {
 
-			if !enoughHeroPlaytime {
-				continue
-			}
+	var (
+		stats PlayerStats
+		err   error
+	)
 
-			heroStatMaps[i], err = putPlayerHeroStatsInMaps(player, heroes[i], heroStatMaps[i], db)
+	role := strings.ToLower(requestValue(c, "role"))
 
-			if err != nil {
-				continue
-			}
-		}
+	if requestValue(c, "player") == "" || role == "" {
+		return stats, errBadRequest("missing_parameters", "Missing required query parameters")
 	}
 
-	for i := 0; i < len(heroes); i++ {
-
-		var statArray [][]string
-
-		heroStatArrays = append(heroStatArrays, statArray)
-		heroStatArrays[i] = sortDictsIntoArrays(heroStatMaps[i])
+	role = handleWeirdRoleNames(role)
+	if findIndexInSlice(roles, role) == -1 {
+		return stats, errBadRequest("unknown_role", fmt.Sprintf("Unknown role %s, expected one of %s", requestValue(c, "role"), strings.Join(roles, ", ")))
 	}
 
-	err = saveHeroStatsLeaderboardToJSON(heroStatArrays, "heroLeaderboards.json")
-
-	return err == nil
-}
+	filter, err := statsFilter(c)
+	if err != nil {
+		return stats, err
+	}
 
-func saveHeroStatsLeaderboardToJSON(arr [][][]string, fileName string) error {
+	db := ConnectToDatabase()
+	defer db.Close()
 
-	file, err := json.MarshalIndent(arr, "", "  ")
+	stats.Name, err = lookupPlayer(requestValue(c, "player"), db)
 	if err != nil {
-		fmt.Println(err, "saveLeaderboardArraysToJSON()")
-		return err
+		return stats, err
 	}
 
-	err = os.WriteFile(fileName, file, 0644)
+	team, err := getPlayerTeam(stats.Name, db)
 	if err != nil {
-		fmt.Println(err, "saveLeaderboardArraysToJSON()")
-		return err
+		return stats, errInternal(err, "An error occured while fetching player team")
 	}
 
-	return nil
-}
+	stats, err = getPlayerRoleStats(stats.Name, role, filter, db)
+	if err != nil {
+		return stats, errInternal(err, "An error occured while fetching role stats")
+	}
+	if stats.DurationInSeconds == 0 {
+		return stats, errNotFound("stats_not_found", "No player stats found for this role")
+	}
 
-func loadHeroStatsLeaderboardJSONtoArray(fileName string) ([][][]string, error) {
+	stats.Team, stats.Role = team, role
 
-	var leaderboardArrays [][][]string
+	stats = calcStatsP10(stats)
 
-	file, err := os.ReadFile(fileName)
-	if err != nil {
-		fmt.Println(err, "loadLeaderboardJSONtoArray()")
-		return leaderboardArrays, err
+	if !filter.ranked() {
+		return stats, nil
 	}
 
-	err = json.Unmarshal(file, &leaderboardArrays)
+	stats.Ranks, err = getPlayerRanks(stats.Name, role, "", filter.Season, db)
 	if err != nil {
-		fmt.Println(err, "loadLeaderboardJSONtoArray()")
-		return leaderboardArrays, err
+		return stats, errInternal(err, "An error occured while fetching leaderboard ranks")
 	}
 
-	return leaderboardArrays, nil
-
+	return stats, nil
 }
 
-func putPlayerHeroStatsInMaps(player string, hero string, statMaps []map[string]float64, db *sql.DB) ([]map[string]float64, error) {
-
-	stats := []string{"damageDealt", "damageTaken", "deaths", "finalBlows", "eliminations", "soloKills", "healingDealt", "environmentalKills", "offensiveAssists", "ultsUsed"}
-
-	for i := 0; i < len(stats); i++ {
+func TStats(c *gin.Context) (TeamStats, error) {
 
-		var outputStat float64
-		var outputTime int
- 
-		query := fmt.Sprintf("SELECT %s, durationInSeconds FROM playerHero WHERE player = ? AND hero = ?", stats[i])
-
-		err := db.QueryRow(query, player, hero).Scan(&outputStat, &outputTime)
+	var teamStats TeamStats
 
-		if err != nil {
-			fmt.Println(err, "putPlayerHeroStatsInMaps()")
-			return statMaps, err
-		}
+	teamStats.Team = strings.ToLower(strings.ReplaceAll(requestValue(c, "team"), "_", " "))
 
-		statMaps[i][player] = (outputStat / float64(outputTime)) * 600
+	if teamStats.Team == "" {
+		return teamStats, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
 
+	season, err := seasonParam(c)
+	if err != nil {
+		return teamStats, err
 	}
+	teamStats.Season = season
 
-	return statMaps, nil
-}
+	db := ConnectToDatabase()
+	defer db.Close()
 
-func check10MinutesHeroPlaytime(player string, hero string, db *sql.DB) bool {
+	exists, err := teamExists(teamStats.Team, db)
+	if err != nil {
+		return teamStats, errInternal(err, "Internal server error")
+	}
+	if !exists {
+		return teamStats, errNotFound("team_not_found", "No team stats found")
+	}
 
-	var playtime int
+	teamStats, err = getTeamProfile(teamStats, db)
+	if err != nil {
+		return teamStats, errInternal(err, "Internal server error")
+	}
 
-	query := "SELECT durationInSeconds FROM playerHero WHERE player = ? AND hero = ?"
+	teamStats, err = getTeamStats(teamStats, db)
+	if err != nil {
+		return teamStats, errInternal(err, "Internal server error")
+	}
 
-	err := db.QueryRow(query, player, hero).Scan(&playtime)
+	teamStats, err = getTeamSeries(teamStats, db)
 	if err != nil {
-		return false
+		return teamStats, errInternal(err, "Internal server error")
 	}
-	if playtime < 600 {
-		return false
+
+	division, err := getTeamDivision(teamStats.Team, teamStats.Season, db)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return teamStats, errInternal(err, "Internal server error")
+	}
+	if err == nil {
+		teamStats.Division = &division
 	}
-	return true
-}
 
-func calculateGeneralStatLeaderboards() bool {
+	return teamStats, nil
+}
 
-	var player string
+func TStatsMap(c *gin.Context) (TeamStats, error) {
 
-	db := ConnectToDatabase()
+	var teamStats TeamStats
 
-	leaderboardDicts := createDicts()
+	teamStats.Team = strings.ToLower(strings.ReplaceAll(requestValue(c, "team"), "_", " "))
+	mapName := strings.ToLower(strings.ReplaceAll(requestValue(c, "map"), "_", " "))
 
-	rows, err := db.Query("SELECT name FROM player")
+	if teamStats.Team == "" || mapName == "" {
+		return teamStats, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
 
+	season, err := seasonParam(c)
 	if err != nil {
-		fmt.Println(err, "calculateStatLeaderboards()")
-		return false
+		return teamStats, err
 	}
+	teamStats.Season = season
 
-	for rows.Next() {
+	mapName, found := resolveMapName(mapName)
+	if !found {
+		return teamStats, errBadRequest("unknown_map", fmt.Sprintf("Unknown map %s", requestValue(c, "map")))
+	}
 
-		err := rows.Scan(&player)
+	db := ConnectToDatabase()
+	defer db.Close()
 
-		if err != nil {
-			fmt.Println(err, "calculateStatLeaderboards()")
-			return false
-		}
+	exists, err := teamExists(teamStats.Team, db)
+	if err != nil {
+		return teamStats, errInternal(err, "Internal server error")
+	}
+	if !exists {
+		return teamStats, errNotFound("team_not_found", "No stats found")
+	}
 
-		enoughTimePlayed := check30MinutesTotalPlaytime(player, db)
+	teamStats, err = getTeamProfile(teamStats, db)
+	if err != nil {
+		return teamStats, errInternal(err, "Internal server error")
+	}
 
-		if !enoughTimePlayed {
-			continue
-		}
+	teamStats, err = getTeamMapStats(teamStats, mapName, db)
+	if err != nil {
+		return teamStats, errInternal(err, "Internal server error")
+	}
+
+	return teamStats, nil
+}
 
-		leaderboardDicts, err = putPlayerStatsInDicts(player, leaderboardDicts, db)
+// UpdateLeaderboards rebuilds the all-time leaderboards, or a single season's
+// when a season is given.
+func UpdateLeaderboards(c *gin.Context) (string, error) {
 
-		if err != nil {
-			return false
-		}
+	season, err := seasonParam(c)
+	if err != nil {
+		return "", err
+	}
 
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", errInternal(err, "Error updating leaderboards")
 	}
+	defer tx.Rollback()
 
-	leaderboardArrays := sortDictsIntoArrays(leaderboardDicts)
+	err = updateLeaderboards(season, nil, formatTime(time.Now()), tx)
+	if err != nil {
+		return "", errInternal(err, "Error updating leaderboards")
+	}
 
-	err = saveGeneralLeaderboardArraysToJSON(leaderboardArrays, "leaderboards.json")
+	err = tx.Commit()
+	if err != nil {
+		return "", errInternal(err, "Error updating leaderboards")
+	}
 
-	return err == nil
+	if season != 0 {
+		return fmt.Sprintf("Season %d leaderboards successfully updated", season), nil
+	}
 
+	return "Leaderboards successfully updated", nil
 }
 
-func saveGeneralLeaderboardArraysToJSON(arr [][]string, fileName string) error {
+func getMatchTeams(matchID int, db queryer) ([2]string, error) {
 
-	file, err := json.MarshalIndent(arr, "", "  ")
-	if err != nil {
-		fmt.Println(err, "saveLeaderboardArraysToJSON()")
-		return err
-	}
+	var teams [2]string
 
-	err = os.WriteFile(fileName, file, 0644)
+	err := db.QueryRow("SELECT team1, team2 FROM game WHERE ID = ?", matchID).Scan(&teams[0], &teams[1])
 	if err != nil {
-		fmt.Println(err, "saveLeaderboardArraysToJSON()")
-		return err
+		return teams, err
 	}
 
-	return nil
+	return teams, nil
 }
 
-func loadGeneralLeaderboardJSONtoArray(fileName string) ([][]string, error) {
+func teamExists(team string, db queryer) (bool, error) {
 
-	var leaderboardArrays [][]string
+	var count int
 
-	file, err := os.ReadFile(fileName)
+	err := db.QueryRow("SELECT COUNT(*) FROM team WHERE name = ?", team).Scan(&count)
 	if err != nil {
-		fmt.Println(err, "loadLeaderboardJSONtoArray()")
-		return leaderboardArrays, err
+		return false, err
 	}
 
-	err = json.Unmarshal(file, &leaderboardArrays)
+	return count > 0, nil
+}
+
+// getTeamProfile fills in how the team is presented.
+func getTeamProfile(teamStats TeamStats, db *sql.DB) (TeamStats, error) {
+
+	team, err := getTeam(teamStats.Team, db)
 	if err != nil {
-		fmt.Println(err, "loadLeaderboardJSONtoArray()")
-		return leaderboardArrays, err
+		return teamStats, err
 	}
 
-	return leaderboardArrays, nil
+	teamStats.DisplayName, teamStats.Tag, teamStats.LogoURL = team.DisplayName, team.Tag, team.LogoURL
 
+	return teamStats, nil
 }
 
-func generalLeaderboardRanks(leaderboards [][]string, player string) []int {
+func getTeamMapStats(teamStats TeamStats, mapName string, db *sql.DB) (TeamStats, error) {
+
+	var winner string
 
-	var ranks []int
+	err := db.QueryRow("SELECT seasonsPlayed FROM team WHERE name = ?", teamStats.Team).Scan(&teamStats.SeasonsPlayed)
+	if err != nil {
+		return teamStats, err
+	}
 
-	for i := 0; i < len(leaderboards); i++ {
+	query := "SELECT COALESCE(map.winner, 'draw') FROM map JOIN game ON map.gameID = game.ID WHERE (game.team1 = ? OR game.team2 = ?) AND map.name = ? AND (? = 0 OR game.seasonID = ?)"
 
-		ranks = append(ranks, 0)
+	rows, err := db.Query(query, teamStats.Team, teamStats.Team, mapName, teamStats.Season, teamStats.Season)
 
-		for j := 0; j < len(leaderboards[i]); j++ {
+	if err != nil {
+		return teamStats, err
+	}
 
-			if leaderboards[i][j] == player {
-				ranks[i] = j + 1
-				break
-			}
+	defer rows.Close()
 
+	for rows.Next() {
+		
+		err := rows.Scan(&winner)
+		if err != nil {
+			return teamStats, err
 		}
 
+		if winner == "draw" {
+			teamStats.MapDraws += 1
+		} else if winner == teamStats.Team {
+			teamStats.MapWins += 1
+		} else {
+			teamStats.MapLosses += 1
+		}
 	}
 
-	return ranks
+	return teamStats, nil
 
 }
 
-func sortDictsIntoArrays(leaderboardDicts []map[string]float64) [][]string {
+func getTeamStats(teamStats TeamStats, db *sql.DB) (TeamStats, error) {
+
+	var (
+		winner  string
+		mapName string
+	)
 
-	var leaderboardArrays [][]string
+	err := db.QueryRow("SELECT seasonsPlayed FROM team WHERE name = ?", teamStats.Team).Scan(&teamStats.SeasonsPlayed)
+	if err != nil {
+		return teamStats, err
+	}
 
-	for i := 0; i < 10; i++ {
+	query := "SELECT map.name, COALESCE(map.winner, 'draw') FROM map JOIN game ON map.gameID = game.ID WHERE (game.team1 = ? OR game.team2 = ?) AND (? = 0 OR game.seasonID = ?)"
 
-		var stringSlice []string
+	rows, err := db.Query(query, teamStats.Team, teamStats.Team, teamStats.Season, teamStats.Season)
 
-		leaderboardArrays = append(leaderboardArrays, stringSlice)
+	if err != nil {
+		return teamStats, err
+	}
 
-		for j := 0; j < 10; j++ {
+	defer rows.Close()
 
-			maxStat := 0.0
-			maxStatPlayer := ""
+	for rows.Next() {
 
-			for player, stat := range leaderboardDicts[i] {
-				if stat <= maxStat {
-					continue
-				}
-				maxStat = stat
-				maxStatPlayer = player
+		err := rows.Scan(&mapName, &winner)
+		if err != nil {
+			return teamStats, err
+		}
+
+		found := false
+		for i := 0; i < len(teamStats.Maps); i++ {
+
+			if mapName != teamStats.Maps[i].Name {
+				continue
 			}
 
-			if maxStatPlayer != "" {
-				leaderboardArrays[i] = append(leaderboardArrays[i], maxStatPlayer)
+			if winner == "draw" {
+				teamStats.Maps[i].Draws += 1
+				teamStats.MapDraws += 1
+				found = true
+			} else if winner == teamStats.Team {
+				teamStats.Maps[i].Wins += 1
+				teamStats.MapWins += 1
+				found = true
+			} else {
+				teamStats.Maps[i].Losses += 1
+				teamStats.MapLosses += 1
+				found = true
 			}
 
-			delete(leaderboardDicts[i], maxStatPlayer)
 		}
+		if !found {
+
+			if winner == "draw" {
+				teamStats.Maps = append(teamStats.Maps, MapStats{Name: mapName, Draws: 1, Wins: 0, Losses: 0})
+				teamStats.MapDraws += 1
+			} else if winner == teamStats.Team {
+				teamStats.Maps = append(teamStats.Maps, MapStats{Name: mapName, Draws: 0, Wins: 1, Losses: 0})
+				teamStats.MapWins += 1
+			} else {
+				teamStats.Maps = append(teamStats.Maps, MapStats{Name: mapName, Draws: 0, Wins: 0, Losses: 1})
+				teamStats.MapLosses += 1
+			}
+		}
+
 	}
 
-	return leaderboardArrays
+	return teamStats, nil
 }
 
-func putPlayerStatsInDicts(player string, leaderboardDicts []map[string]float64, db *sql.DB) ([]map[string]float64, error) {
-
-	stats := []string{"damageDealt", "damageTaken", "deaths", "finalBlows", "eliminations", "soloKills", "healingDealt", "environmentalKills", "offensiveAssists", "ultsUsed"}
+func formatTeamStatsMessage(stats TeamStats) string {
 
-	for i := range stats {
+	var (
+		mostPlayedMaps []MapStats
+		mp int
+		response string
+	)
 
-		queryStat := stats[i]
-		var outputStat float64
-		var outputTime int
+	percent := "%"
 
-		query := fmt.Sprintf("SELECT SUM(%s), SUM(durationInSeconds) FROM mapPlayer WHERE player = ?", queryStat)
+	if len(stats.Maps) > 0 {
 
-		err := db.QueryRow(query, player).Scan(&outputStat, &outputTime)
+		var length int
 
-		if err != nil {
-			fmt.Println(err, "putPlayerStatsInDicts()")
-			return leaderboardDicts, err
+		if len(stats.Maps) < 3 {
+			length = len(stats.Maps)
+		} else {
+			length = 3
 		}
 
-		leaderboardDicts[i][player] = (outputStat / float64(outputTime)) * 600
-
-	}
+		response = "Most played maps:\n"
+		for i := 0; i < length; i++ {
+			counter := 0
+			for j := 0; j < len(stats.Maps); j++ {
+				if (stats.Maps[i].Wins + stats.Maps[i].Losses + stats.Maps[i].Draws) > counter {
+					mp = i
+				}
+			}
+			mostPlayedMaps = append(mostPlayedMaps, stats.Maps[mp])
+			
 
-	return leaderboardDicts, nil
+			wr := (float64(mostPlayedMaps[i].Wins) / float64((mostPlayedMaps[i].Wins + mostPlayedMaps[i].Losses))) * 100
 
-}
+			stats.Maps[mp].Wins, stats.Maps[mp].Losses, stats.Maps[mp].Draws = 0, 0, 0
 
-func check30MinutesTotalPlaytime(player string, db *sql.DB) bool {
-	var durationInSeconds int
+			response += fmt.Sprintf("%s: %.2f%s W/L\n", capitalizeFirstLetterOfEachWord(mostPlayedMaps[i].Name), wr, percent)
+		}
+		response += "\n"
+	}
 
-	query := "SELECT SUM(durationInSeconds) FROM mapPlayer WHERE player = ?"
+	response += fmt.Sprintf("Match Wins: %d\nMatch Losses: %d\n", stats.MatchWins, stats.MatchLosses)
+	if stats.MatchDraws > 0 {
+		response += fmt.Sprintf("Match Draws: %d\n", stats.MatchDraws)
+	}
 
-	err := db.QueryRow(query, player).Scan(&durationInSeconds)
+	response += fmt.Sprintf("Map Wins: %d\nMap Losses: %d\nMap Draws: %d", stats.MapWins, stats.MapLosses, stats.MapDraws)
 
-	if err != nil {
-		return false
-	}
-	if durationInSeconds < 1800 {
-		return false
+	if stats.Division != nil {
+		response = fmt.Sprintf("Division: %s\n\n", stats.Division.Name) + response
 	}
-	return true
-}
-
-func createDicts() []map[string]float64 {
-
-	var leaderboardDicts []map[string]float64
-
-	damageDealtDict := make(map[string]float64)
-	damageTakenDict := make(map[string]float64)
-	deathsDict := make(map[string]float64)
-	finalBlowsDict := make(map[string]float64)
-	eliminationsDict := make(map[string]float64)
-	soloKillsDict := make(map[string]float64)
-	healingDealtDict := make(map[string]float64)
-	environmentalKillsDict := make(map[string]float64)
-	offensiveAssistsDict := make(map[string]float64)
-	ultsUsedDict := make(map[string]float64)
-
-	// Dict =/= Dick
-	leaderboardDicts = append(leaderboardDicts, damageDealtDict)
-	leaderboardDicts = append(leaderboardDicts, damageTakenDict)
-	leaderboardDicts = append(leaderboardDicts, deathsDict)
-	leaderboardDicts = append(leaderboardDicts, finalBlowsDict)
-	leaderboardDicts = append(leaderboardDicts, eliminationsDict)
-	leaderboardDicts = append(leaderboardDicts, soloKillsDict)
-	leaderboardDicts = append(leaderboardDicts, healingDealtDict)
-	leaderboardDicts = append(leaderboardDicts, environmentalKillsDict)
-	leaderboardDicts = append(leaderboardDicts, offensiveAssistsDict)
-	leaderboardDicts = append(leaderboardDicts, ultsUsedDict)
-
-	return leaderboardDicts
-}
 
-func handleWeirdHeroNames(hero string) string {
+	return response
+} 
 
-	if hero == "lucio" {
-		return "lúcio"
-	}
-	if hero == "jq" || hero == "queen" || hero == "junkerqueen" || hero == "junker" {
-		return "junker queen"
-	}
-	if hero == "dva" || hero == "d" {
-		return "d.va"
-	}
-	if hero == "ball" || hero == "hammond" || hero == "wreckingball" || hero == "hamster" || hero == "wrecking" {
-		return "wrecking ball"
-	}
-	if hero == "torb" || hero == "torbjorn" {
-		return "torbjörn"
-	} 
-	if hero == "brig" || hero == "briggite" || hero == "briggitte" {
-		return "brigitte"
-	}
-	if hero == "soldier" || hero == "soldier:76" || hero == "soldier76" || hero == "soldier:" {
-		return "soldier: 76"
-	}
+// getPlayerHeroStats sums a player's per-map stats on a hero. A player who
+// never played the hero gets zero duration rather than an error.
+func getPlayerHeroStats(player string, hero string, filter StatsFilter, db queryer) (PlayerStats, error) {
+	return sumPlayerHeroStats(player, []string{hero}, filter, db)
+}
 
-	return hero
+// getPlayerRoleStats sums a player's per-map stats over every hero of a role.
+func getPlayerRoleStats(player string, role string, filter StatsFilter, db queryer) (PlayerStats, error) {
+	return sumPlayerHeroStats(player, roleHeroes(role), filter, db)
 }
 
-func getPlayerHeroStats(player string, hero string, db *sql.DB) (PlayerStats, error) {
+func sumPlayerHeroStats(player string, heroes []string, filter StatsFilter, db queryer) (PlayerStats, error) {
 
 	var stats PlayerStats
 
 	stats.Name = player
 
-	query := "SELECT damageDealt, damageTaken, deaths, finalBlows, eliminations, soloKills, healingDealt, environmentalKills, offensiveAssists, ultsUsed, durationInSeconds FROM playerHero WHERE player = ? AND hero = ?"
+	condition, args := filter.sql("mapPlayerHero")
 
-	err := db.QueryRow(query, player, hero).Scan(&stats.DamageDealt, &stats.DamageTaken, &stats.Deaths, &stats.FinalBlows, &stats.Eliminations, &stats.SoloKills, &stats.HealingDealt, &stats.EnvironmentalKills, &stats.OffensiveAssists, &stats.UltsUsed, &stats.DurationInSeconds)
+	query := "SELECT COALESCE(SUM(damageDealt), 0), COALESCE(SUM(damageTaken), 0), COALESCE(SUM(deaths), 0), COALESCE(SUM(finalBlows), 0), COALESCE(SUM(eliminations), 0), COALESCE(SUM(soloKills), 0), COALESCE(SUM(healingDealt), 0), COALESCE(SUM(environmentalKills), 0), COALESCE(SUM(offensiveAssists), 0), COALESCE(SUM(ultsUsed), 0), COALESCE(SUM(durationInSeconds), 0) FROM mapPlayerHero WHERE player = ? AND hero IN (?" + strings.Repeat(", ?", len(heroes)-1) + ")" + condition
+
+	queryArgs := []any{player}
+	for _, hero := range heroes {
+		queryArgs = append(queryArgs, hero)
+	}
+
+	err := db.QueryRow(query, append(queryArgs, args...)...).Scan(&stats.DamageDealt, &stats.DamageTaken, &stats.Deaths, &stats.FinalBlows, &stats.Eliminations, &stats.SoloKills, &stats.HealingDealt, &stats.EnvironmentalKills, &stats.OffensiveAssists, &stats.UltsUsed, &stats.DurationInSeconds)
 
 	if err != nil {
 		return stats, err
@@ -806,7 +1001,7 @@ func getPlayerHeroStats(player string, hero string, db *sql.DB) (PlayerStats, er
 
 }
 
-func formatCompareMessage(statsDifference [10]float64, playerStats [2]PlayerStats) string {
+func formatCompareMessage(comparison PlayerComparison) string {
 
 	var (
 		message string
@@ -814,8 +1009,10 @@ func formatCompareMessage(statsDifference [10]float64, playerStats [2]PlayerStat
 		arrows2 []string
 	)
 
-	player1 := playerStats[0]
-	player2 := playerStats[1]
+	statsDifference := comparison.Difference.asArray()
+
+	player1 := comparison.Players[0].Per10
+	player2 := comparison.Players[1].Per10
 
 	for i := 0; i < len(statsDifference); i++ {
 
@@ -841,7 +1038,7 @@ func formatCompareMessage(statsDifference [10]float64, playerStats [2]PlayerStat
 
 	message = fmt.Sprintf(
 		"%s vs %s\n\n",
-		player1.Name, player2.Name,
+		comparison.Players[0].Name, comparison.Players[1].Name,
 	)
 
 	message += fmt.Sprintf("DD: %.2f %s %.2f %s %.2f\n", player1.DamageDealt, arrows1[0], math.Abs(statsDifference[0]), arrows2[0], player2.DamageDealt)
@@ -859,61 +1056,86 @@ func formatCompareMessage(statsDifference [10]float64, playerStats [2]PlayerStat
 	return message
 }
 
-func playerStatsDifference(playerStats [2]PlayerStats) [10]float64 {
+func playerStatsDifference(playerStats [2]PlayerStats) StatsP10 {
 
-	var statsDifference [10]float64
+	var statsDifference StatsP10
 
-	statsDifference[0] = playerStats[0].DamageDealt - playerStats[1].DamageDealt
-	statsDifference[1] = playerStats[0].DamageTaken - playerStats[1].DamageTaken
-	statsDifference[2] = playerStats[0].Deaths - playerStats[1].Deaths
-	statsDifference[3] = playerStats[0].FinalBlows - playerStats[1].FinalBlows
-	statsDifference[4] = playerStats[0].Eliminations - playerStats[1].Eliminations
-	statsDifference[5] = playerStats[0].SoloKills - playerStats[1].SoloKills
-	statsDifference[6] = playerStats[0].HealingDealt - playerStats[1].HealingDealt
-	statsDifference[7] = playerStats[0].EnvironmentalKills - playerStats[1].EnvironmentalKills
-	statsDifference[8] = playerStats[0].OffensiveAssists - playerStats[1].OffensiveAssists
-	statsDifference[9] = playerStats[0].UltsUsed - playerStats[1].UltsUsed
+	player1, player2 := playerStats[0].Per10, playerStats[1].Per10
+
+	statsDifference.DamageDealt = player1.DamageDealt - player2.DamageDealt
+	statsDifference.DamageTaken = player1.DamageTaken - player2.DamageTaken
+	statsDifference.Deaths = player1.Deaths - player2.Deaths
+	statsDifference.FinalBlows = player1.FinalBlows - player2.FinalBlows
+	statsDifference.Eliminations = player1.Eliminations - player2.Eliminations
+	statsDifference.SoloKills = player1.SoloKills - player2.SoloKills
+	statsDifference.HealingDealt = player1.HealingDealt - player2.HealingDealt
+	statsDifference.EnvironmentalKills = player1.EnvironmentalKills - player2.EnvironmentalKills
+	statsDifference.OffensiveAssists = player1.OffensiveAssists - player2.OffensiveAssists
+	statsDifference.UltsUsed = player1.UltsUsed - player2.UltsUsed
 
 	return statsDifference
 }
 
-func createMap(mapInfo Map) int {
-
-	db := ConnectToDatabase()
+func createMap(mapInfo Map, db queryer) (int, error) {
 
-	var mapID int
+	var (
+		mapID  int
+		winner any
+	)
 
-	sql := `INSERT INTO map (gameID, name, winner, durationInSeconds) VALUES (?, ?, ?, ?)`
+	// map.winner references a team, so draws are stored without a winner
+	if mapInfo.Winner != "draw" {
+		winner = mapInfo.Winner
+	}
 
-	statement, err := db.Prepare(sql)
+	sql := `INSERT INTO map (gameID, name, winner, durationInSeconds, logHash, playedAt) VALUES (?, ?, ?, ?, ?, ?)`
 
+	_, err := db.Exec(sql, mapInfo.MatchID, mapInfo.Name, winner, mapInfo.TotalTimeInSeconds, mapInfo.LogHash, formatTime(time.Now()))
 	if err != nil {
-		fmt.Println(err, "CreateMap()")
+		return mapID, fmt.Errorf("createMap(): %w", err)
 	}
-	_, err = statement.Exec(mapInfo.MatchID, mapInfo.Name, mapInfo.Winner, mapInfo.TotalTimeInSeconds)
 
+	err = db.QueryRow("SELECT MAX(ID) FROM map").Scan(&mapID)
 	if err != nil {
-		fmt.Println(err, "createMap()")
+		return mapID, fmt.Errorf("createMap(): %w", err)
 	}
 
-	db.Close()
+	return mapID, nil
+}
+
+// updateMap replaces the log of a map. The map keeps the time it was first
+// played at, maps from before playedAt was recorded get the current time.
+func updateMap(mapID int, mapInfo Map, db queryer) error {
 
-	db = ConnectToDatabase()
-	defer db.Close()
+	var winner any
 
-	err = db.QueryRow("SELECT MAX(ID) FROM map").Scan(&mapID)
+	if mapInfo.Winner != "draw" {
+		winner = mapInfo.Winner
+	}
+
+	_, err := db.Exec("UPDATE map SET name = ?, winner = ?, durationInSeconds = ?, logHash = ?, playedAt = COALESCE(playedAt, ?) WHERE ID = ?", mapInfo.Name, winner, mapInfo.TotalTimeInSeconds, mapInfo.LogHash, formatTime(time.Now()), mapID)
 	if err != nil {
-		fmt.Println(err, "createMap()")
+		return fmt.Errorf("updateMap(): %w", err)
 	}
 
-	return mapID
+	return nil
 }
 
-func saveStatsToDB(playerStats [10]PlayerStats, mapID int, timePlayed int) string {
-	var response string
+// deleteMapStats removes everything ingested from a map's log. The map row
+// itself is kept.
+func deleteMapStats(mapID int, db queryer) error {
 
-	db := ConnectToDatabase()
-	defer db.Close()
+	for _, table := range []string{"mapPlayerHero", "mapPlayer", "mapTimeline", "mapRound"} {
+		_, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE mapID = ?", table), mapID)
+		if err != nil {
+			return fmt.Errorf("deleteMapStats() - Deleting from %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+func saveStatsToDB(playerStats []PlayerStats, mapID int, db queryer) error {
 
 	for i := 0; i < len(playerStats); i++ {
 		playerName := strings.ToLower(playerStats[i].Name)
@@ -922,34 +1144,21 @@ func saveStatsToDB(playerStats [10]PlayerStats, mapID int, timePlayed int) strin
 		var count int
 		err := db.QueryRow("SELECT COUNT(*) FROM player WHERE name = ?", playerName).Scan(&count)
 		if err != nil {
-			fmt.Println(err, "saveStatsToDB() - Checking player existence")
-			continue
+			return fmt.Errorf("saveStatsToDB() - Checking player existence: %w", err)
 		}
 
 		if count == 0 {
-			sql := `INSERT INTO player (name, team) VALUES (?, ?)`
-			statement, err := db.Prepare(sql)
-			if err != nil {
-				fmt.Println(err, "saveStatsToDB() - Preparing player insert statement")
-				continue
-			}
-			_, err = statement.Exec(playerName, teamName)
+			sql := `INSERT INTO player (ID, name, team) VALUES ((SELECT COALESCE(MAX(ID), 0) + 1 FROM player), ?, ?)`
+			_, err = db.Exec(sql, playerName, teamName)
 			if err != nil {
-				fmt.Println(err, "saveStatsToDB() - Executing player insert")
-				continue
+				return fmt.Errorf("saveStatsToDB() - Executing player insert: %w", err)
 			}
 		}
 
-		stmt := `INSERT INTO mapPlayer (mapID, player, damageDealt, damageTaken, deaths, finalBlows, eliminations, soloKills, healingDealt, environmentalKills, offensiveAssists, ultsUsed, durationInSeconds) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-		statement, err := db.Prepare(stmt)
-		if err != nil {
-			fmt.Println(err, "saveStatsToDB() - Preparing map player insert statement")
-			continue
-		}
-		_, err = statement.Exec(mapID, playerName, playerStats[i].DamageDealt, playerStats[i].DamageTaken, playerStats[i].Deaths, playerStats[i].FinalBlows, playerStats[i].Eliminations, playerStats[i].SoloKills, playerStats[i].HealingDealt, playerStats[i].EnvironmentalKills, playerStats[i].OffensiveAssists, playerStats[i].UltsUsed, timePlayed)
+		stmt := `INSERT INTO mapPlayer (mapID, player, team, damageDealt, damageTaken, deaths, finalBlows, eliminations, soloKills, healingDealt, environmentalKills, offensiveAssists, ultsUsed, durationInSeconds) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		_, err = db.Exec(stmt, mapID, playerName, teamName, playerStats[i].DamageDealt, playerStats[i].DamageTaken, playerStats[i].Deaths, playerStats[i].FinalBlows, playerStats[i].Eliminations, playerStats[i].SoloKills, playerStats[i].HealingDealt, playerStats[i].EnvironmentalKills, playerStats[i].OffensiveAssists, playerStats[i].UltsUsed, playerStats[i].DurationInSeconds)
 		if err != nil {
-			fmt.Println(err, "saveStatsToDB() - Executing map player insert")
-			continue
+			return fmt.Errorf("saveStatsToDB() - Executing map player insert: %w", err)
 		}
 
 		for j := 0; j < len(playerStats[i].Heroes); j++ {
@@ -967,43 +1176,23 @@ func saveStatsToDB(playerStats [10]PlayerStats, mapID int, timePlayed int) strin
 			offensiveAssists := playerHero.OffensiveAssists
 			ultsUsed := playerHero.UltsUsed
 
-			// Check if player-hero exists
-			err := db.QueryRow("SELECT COUNT(*) FROM playerHero WHERE player = ? AND hero = ?", playerName, heroName).Scan(&count)
+			stmt = `INSERT INTO mapPlayerHero (mapID, player, hero, damageDealt, damageTaken, deaths, finalBlows, eliminations, soloKills, healingDealt, environmentalKills, offensiveAssists, ultsUsed, durationInSeconds) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+			_, err = db.Exec(stmt, mapID, playerName, heroName, damageDealt, damageTaken, deaths, finalBlows, eliminations, soloKills, healingDealt, environmentalKills, offensiveAssists, ultsUsed, durationInSeconds)
 			if err != nil {
-				fmt.Println(err, "saveStatsToDB() - Checking player-hero existence")
-				continue
+				return fmt.Errorf("saveStatsToDB() - Executing map player-hero insert: %w", err)
 			}
 
-			if count == 0 {
-				stmt = `INSERT INTO playerHero (player, hero, damageDealt, damageTaken, deaths, finalBlows, eliminations, soloKills, healingDealt, environmentalKills, offensiveAssists, ultsUsed, durationInSeconds) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-				statement, err := db.Prepare(stmt)
-				if err != nil {
-					fmt.Println(err, "saveStatsToDB() - Preparing player-hero insert statement")
-					continue
-				}
-				_, err = statement.Exec(playerName, heroName, damageDealt, damageTaken, deaths, finalBlows, eliminations, soloKills, healingDealt, environmentalKills, offensiveAssists, ultsUsed, durationInSeconds)
-				if err != nil {
-					fmt.Println(err, "saveStatsToDB() - Executing player-hero insert")
-					continue
-				}
-			} else {
-				_, err := db.Exec("UPDATE playerHero SET damageDealt = damageDealt + ? AND damageTaken = damageTaken + ? AND deaths = deaths + ? AND finalBlows = finalBlows + ? AND eliminations = eliminations + ? AND soloKills = soloKills + ? AND healingDealt = healingDealt + ? AND environmentalKills = environmentalKills + ? AND offensiveAssists = offensiveAssists + ? AND ultsUsed = ultsUsed + ? AND durationInSeconds = durationInSeconds + ? WHERE player = ? AND hero = ?",
-					damageDealt, damageTaken, deaths, finalBlows, eliminations, soloKills, healingDealt, environmentalKills, offensiveAssists, ultsUsed, durationInSeconds, playerName, heroName)
-				if err != nil {
-					fmt.Println(err, "saveStatsToDB() - Updating player-hero time")
-					continue
-				}
-			}
 		}
 	}
 
-	response = "Stats added successfully."
-	return response
+	return nil
 }
 
-func getPlayerStats(totalStats PlayerStats, db *sql.DB) (PlayerStats, error) {
+func getPlayerStats(totalStats PlayerStats, filter StatsFilter, db queryer) (PlayerStats, error) {
+
+	condition, args := filter.sql("mapPlayer")
 
-	rows, err := db.Query("SELECT damageDealt, damageTaken, deaths, finalBlows, eliminations, soloKills, healingDealt, environmentalKills, offensiveAssists, ultsUsed, durationInSeconds FROM mapPlayer WHERE player = ?", totalStats.Name)
+	rows, err := db.Query("SELECT damageDealt, damageTaken, deaths, finalBlows, eliminations, soloKills, healingDealt, environmentalKills, offensiveAssists, ultsUsed, durationInSeconds FROM mapPlayer WHERE player = ?"+condition, append([]any{totalStats.Name}, args...)...)
 
 	if err != nil {
 		return totalStats, err
@@ -1015,7 +1204,6 @@ func getPlayerStats(totalStats PlayerStats, db *sql.DB) (PlayerStats, error) {
 		var stats PlayerStats
 		err := rows.Scan(&stats.DamageDealt, &stats.DamageTaken, &stats.Deaths, &stats.FinalBlows, &stats.Eliminations, &stats.SoloKills, &stats.HealingDealt, &stats.EnvironmentalKills, &stats.OffensiveAssists, &stats.UltsUsed, &stats.DurationInSeconds)
 		if err != nil {
-			fmt.Println(err, "getPlayerStats()")
 			return totalStats, err
 		}
 
@@ -1034,7 +1222,6 @@ func getPlayerStats(totalStats PlayerStats, db *sql.DB) (PlayerStats, error) {
 	}
 
 	if err = rows.Err(); err != nil {
-		fmt.Println(err, "getPlayerStats()")
 		return totalStats, err
 	}
 
@@ -1043,28 +1230,33 @@ func getPlayerStats(totalStats PlayerStats, db *sql.DB) (PlayerStats, error) {
 
 func calcStatsP10(stats PlayerStats) PlayerStats {
 
-	stats.DamageDealt = stats.DamageDealt / float64(stats.DurationInSeconds) * 600
-	stats.DamageTaken = stats.DamageTaken / float64(stats.DurationInSeconds) * 600
-	stats.Deaths = stats.Deaths / float64(stats.DurationInSeconds) * 600
-	stats.FinalBlows = stats.FinalBlows / float64(stats.DurationInSeconds) * 600
-	stats.Eliminations = stats.Eliminations / float64(stats.DurationInSeconds) * 600
-	stats.SoloKills = stats.SoloKills / float64(stats.DurationInSeconds) * 600
-	stats.HealingDealt = stats.HealingDealt / float64(stats.DurationInSeconds) * 600
-	stats.EnvironmentalKills = stats.EnvironmentalKills / float64(stats.DurationInSeconds) * 600
-	stats.OffensiveAssists = stats.OffensiveAssists / float64(stats.DurationInSeconds) * 600
-	stats.UltsUsed = stats.UltsUsed / float64(stats.DurationInSeconds) * 600
+	if stats.DurationInSeconds == 0 {
+		return stats
+	}
+
+	stats.Per10.DamageDealt = stats.DamageDealt / float64(stats.DurationInSeconds) * 600
+	stats.Per10.DamageTaken = stats.DamageTaken / float64(stats.DurationInSeconds) * 600
+	stats.Per10.Deaths = stats.Deaths / float64(stats.DurationInSeconds) * 600
+	stats.Per10.FinalBlows = stats.FinalBlows / float64(stats.DurationInSeconds) * 600
+	stats.Per10.Eliminations = stats.Eliminations / float64(stats.DurationInSeconds) * 600
+	stats.Per10.SoloKills = stats.SoloKills / float64(stats.DurationInSeconds) * 600
+	stats.Per10.HealingDealt = stats.HealingDealt / float64(stats.DurationInSeconds) * 600
+	stats.Per10.EnvironmentalKills = stats.EnvironmentalKills / float64(stats.DurationInSeconds) * 600
+	stats.Per10.OffensiveAssists = stats.OffensiveAssists / float64(stats.DurationInSeconds) * 600
+	stats.Per10.UltsUsed = stats.UltsUsed / float64(stats.DurationInSeconds) * 600
 
 	return stats
 }
 
-func getTop3Heroes(stats PlayerStats, db *sql.DB) (PlayerStats, error) {
+func getTop3Heroes(stats PlayerStats, filter StatsFilter, db *sql.DB) (PlayerStats, error) {
 
-	sql := `SELECT hero, durationInSeconds FROM playerHero WHERE player = ? ORDER BY durationInSeconds DESC LIMIT 3`
+	condition, args := filter.sql("mapPlayerHero")
 
-	rows, err := db.Query(sql, stats.Name)
+	sql := `SELECT hero, SUM(durationInSeconds) AS timePlayed FROM mapPlayerHero WHERE player = ?` + condition + ` GROUP BY hero ORDER BY timePlayed DESC LIMIT 3`
+
+	rows, err := db.Query(sql, append([]any{stats.Name}, args...)...)
 
 	if err != nil {
-		fmt.Println(err, "getTop3Heroes()")
 		return stats, err
 	}
 
@@ -1074,7 +1266,6 @@ func getTop3Heroes(stats PlayerStats, db *sql.DB) (PlayerStats, error) {
 		var heroStats HeroStats
 		err := rows.Scan(&heroStats.Hero, &heroStats.TimeSpentInSeconds)
 		if err != nil {
-			fmt.Println(err, "getTop3Heroes()")
 			return stats, err
 		}
 		stats.Heroes = append(stats.Heroes, heroStats)
@@ -1089,25 +1280,19 @@ func getPlayerTeam(player string, db *sql.DB) (string, error) {
 
 	err := db.QueryRow("SELECT team FROM player WHERE name = ?", player).Scan(&team)
 	if err != nil {
-		fmt.Println(err, "getPlayerTeam()")
 		return team, err
 	}
 	return team, nil
 }
 
-func formatPlayerStatsMessage(stats PlayerStats, heroPointer *string) string {
+func formatPlayerStatsMessage(stats PlayerStats) string {
 
-	var (
-		heroInfo string
-		ranks    []int
-	)
+	var heroInfo string
 
-	heroes := []string{"ana", "ashe", "baptiste", "bastion", "brigitte", "cassidy", "d.va", "doomfist", "echo", "genji", "hanzo", "illari", "junker queen", "junkrat", "juno", "kiriko", "lifeweaver", "lúcio",
-		"mauga", "mei", "mercy", "moira", "orisa", "pharah", "ramattra", "reaper", "reinhardt", "roadhog", "sigma", "sojourn", "soldier: 76", "sombra", "symmetra", "torbjörn", "tracer",
-		"venture", "widowmaker", "winston", "wrecking ball", "zarya", "zenyatta"}
+	labels := []string{"Damage Dealt", "Damage Taken", "Deaths", "Final Blows", "Eliminations", "Solo Kills", "Healing Dealt", "Environmental Kills", "Offensive Assists", "Ultimates Used"}
 
 	if len(stats.Heroes) > 0 {
-		heroInfo = fmt.Sprintf("Team: %s\n\nMost Played Heroes:\n", capitalizeFirstLetterOfEachWord(stats.Team))
+		heroInfo = fmt.Sprintf("Team: %s\n\nMost Played Heroes:\n", teamDisplayName(stats.Team))
 		for i := range stats.Heroes {
 
 			var secondsString string
@@ -1127,304 +1312,56 @@ func formatPlayerStatsMessage(stats PlayerStats, heroPointer *string) string {
 				secondsString = fmt.Sprintf("%d", seconds)
 			}
 
-			heroInfo += fmt.Sprintf("%d. %s %s:%s\n", i+1, capitalizeFirstLetterOfEachWord(stats.Heroes[i].Hero), minutesString, secondsString)
-		}
-
-		leaderboards, err := loadGeneralLeaderboardJSONtoArray("leaderboards.json")
-		if err != nil {
-			return "Error loading leaderboards.json"
-		}
-
-		ranks = generalLeaderboardRanks(leaderboards, stats.Name)
-
-		return fmt.Sprintf(
-			"%s\n"+
-				"Damage Dealt: %.2f - %d/%d\n"+
-				"Damage Taken: %.2f - %d/%d\n"+
-				"Deaths: %.2f - %d/%d\n"+
-				"Final Blows: %.2f - %d/%d\n"+
-				"Eliminations: %.2f - %d/%d\n"+
-				"Solo Kills: %.2f - %d/%d\n"+
-				"Healing Dealt: %.2f - %d/%d\n"+
-				"Environmental Kills: %.2f - %d/%d\n"+
-				"Offensive Assists: %.2f - %d/%d\n"+
-				"Ultimates Used: %.2f - %d/%d\n\n"+
-				"All Stats per 10 minutes",
-			heroInfo,
-			stats.DamageDealt, ranks[0], len(leaderboards[0]),
-			stats.DamageTaken, ranks[1], len(leaderboards[1]),
-			stats.Deaths, ranks[2], len(leaderboards[2]),
-			stats.FinalBlows, ranks[3], len(leaderboards[3]),
-			stats.Eliminations, ranks[4], len(leaderboards[4]),
-			stats.SoloKills, ranks[5], len(leaderboards[5]),
-			stats.HealingDealt, ranks[6], len(leaderboards[6]),
-			stats.EnvironmentalKills, ranks[7], len(leaderboards[7]),
-			stats.OffensiveAssists, ranks[8], len(leaderboards[8]),
-			stats.UltsUsed, ranks[9], len(leaderboards[9]),
-		)
-
-	} else {
-
-		if heroPointer == nil {
-			return "Error fetching hero"
-		}
-
-		leaderboards, err := loadHeroStatsLeaderboardJSONtoArray("heroLeaderboards.json")
-		if err != nil {
-			return "Error loading heroLeaderboards.json"
-		}
-
-		heroIndex := findIndexInSlice(heroes, *heroPointer)
-
-		ranks := generalLeaderboardRanks(leaderboards[heroIndex], stats.Name)
-
-		return fmt.Sprintf(
-			"%s\n"+
-				"Damage Dealt: %.2f - %d/%d\n"+
-				"Damage Taken: %.2f - %d/%d\n"+
-				"Deaths: %.2f - %d/%d\n"+
-				"Final Blows: %.2f - %d/%d\n"+
-				"Eliminations: %.2f - %d/%d\n"+
-				"Solo Kills: %.2f - %d/%d\n"+
-				"Healing Dealt: %.2f - %d/%d\n"+
-				"Environmental Kills: %.2f - %d/%d\n"+
-				"Offensive Assists: %.2f - %d/%d\n"+
-				"Ultimates Used: %.2f - %d/%d\n\n"+
-				"All Stats per 10 minutes",
-			heroInfo,
-			stats.DamageDealt, ranks[0], len(leaderboards[heroIndex][0]),
-			stats.DamageTaken, ranks[1], len(leaderboards[heroIndex][1]),
-			stats.Deaths, ranks[2], len(leaderboards[heroIndex][2]),
-			stats.FinalBlows, ranks[3], len(leaderboards[heroIndex][3]),
-			stats.Eliminations, ranks[4], len(leaderboards[heroIndex][4]),
-			stats.SoloKills, ranks[5], len(leaderboards[heroIndex][5]),
-			stats.HealingDealt, ranks[6], len(leaderboards[heroIndex][6]),
-			stats.EnvironmentalKills, ranks[7], len(leaderboards[heroIndex][7]),
-			stats.OffensiveAssists, ranks[8], len(leaderboards[heroIndex][8]),
-			stats.UltsUsed, ranks[9], len(leaderboards[heroIndex][9]),
-		)
-	}
-}
-
-func readFile(fileName string) ([10]PlayerStats, Map, error) {
-
-	var (
-		lines       []string
-		playerStats PlayerStats
-		players     [10]PlayerStats
-		prevLines   [10]string
-		playedMap   Map
-	)
-
-	file, err := os.Open(fileName)
-	if err != nil {
-		fmt.Println("Error opening file:", err)
-		return players, playedMap, err
-	}
-
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-
-	prevSeconds, currSeconds, totalTimeInSeconds := 0, 0, 0
-	lineCount := 0
-	setupPhase := false
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		lines = append(lines, line)
-		lineCount++
-		if lineCount <= 10 {
-			players = getPlayerNames(line, lineCount, players)
-		}
-
-		if lineCount%10 == 1 {
-			currSeconds = getCurrentSeconds(line)
-			if currSeconds <= prevSeconds+10 {
-				totalTimeInSeconds += 5
-				setupPhase = false
-			} else {
-				setupPhase = true
-			}
-			prevSeconds = currSeconds
-		}
-
-		if setupPhase {
-			prevLines[(lineCount-1)%10] = line
-		}
-
-		if !setupPhase && lineCount > 10 {
-
-			playerStats, updatedPrevLines := getHeroStats(line, players, prevLines, (lineCount-1)%10)
-
-			for j := 0; j < len(players); j++ {
-				if players[j].Name == playerStats.Name {
-					players[j] = playerStats
-					break
-				}
-			}
-			prevLines = updatedPrevLines
-
-		}
-	}
-
-	start := len(lines) - 10
-	lines = lines[start:]
-
-	for i := 0; i < len(lines); i++ {
-		playerStats = getEndOfGamePlayerStats(lines[i], players, totalTimeInSeconds)
-		for j := 0; j < len(players); j++ {
-			if players[j].Name == playerStats.Name {
-				players[j] = playerStats
-			}
+			heroInfo += fmt.Sprintf("%d. %s %s:%s\n", i+1, heroDisplayName(stats.Heroes[i].Hero), minutesString, secondsString)
 		}
 	}
 
-	playedMap.TotalTimeInSeconds = totalTimeInSeconds
-
-	if err := scanner.Err(); err != nil {
-		fmt.Println("Error reading file:", err)
-		return players, playedMap, err
-	}
-
-	return players, playedMap, nil
-}
+	message := heroInfo + "\n"
 
-func getEndOfGamePlayerStats(line string, players [10]PlayerStats, timePlayed int) PlayerStats {
-
-	stats := strings.Split(line, ",")
-	playerName := stats[1]
-	var player PlayerStats
-
-	for i := 0; i < len(players); i++ {
-		player = players[i]
-		if player.Name == playerName {
-
-			player.DamageDealt, _ = strconv.ParseFloat(stats[3], 64)
-			player.DamageTaken, _ = strconv.ParseFloat(stats[4], 64)
-			player.Deaths, _ = strconv.ParseFloat(stats[5], 64)
-			player.FinalBlows, _ = strconv.ParseFloat(stats[6], 64)
-			player.Eliminations, _ = strconv.ParseFloat(stats[7], 64)
-			player.SoloKills, _ = strconv.ParseFloat(stats[8], 64)
-			player.HealingDealt, _ = strconv.ParseFloat(stats[9], 64)
-			player.EnvironmentalKills, _ = strconv.ParseFloat(stats[10], 64)
-			player.OffensiveAssists, _ = strconv.ParseFloat(stats[11], 64)
-			player.UltsUsed, _ = strconv.ParseFloat(stats[12], 64)
-			player.Team = stats[13]
-			player.DurationInSeconds = timePlayed
-
-			return player
-		}
+	if stats.Role != "" {
+		message = fmt.Sprintf("%s stats for %s:\n\n", capitalizeFirstLetterOfEachWord(stats.Role), stats.Name)
 	}
 
-	return player
-
-}
-
-func getPlayerNames(line string, lineCount int, players [10]PlayerStats) [10]PlayerStats {
+	values := stats.Per10.asArray()
 
-	playerName := strings.Split(line, ",")[1]
-	players[lineCount-1].Name = playerName
+	for i := range labels {
 
-	return players
-}
+		var rank string
 
-func getHeroStats(line string, players [10]PlayerStats, prevLines [10]string, index int) (PlayerStats, [10]string) {
-	stats := strings.Split(line, ",")
-	playerName := stats[1]
-	hero := stats[2]
-	var player PlayerStats
-
-	for i := 0; i < len(players); i++ {
-		player = players[i]
-		if player.Name == playerName {
-			found := false
-			stats := subtractStats(line, prevLines[index])
-			for j := 0; j < len(player.Heroes); j++ {
-				if player.Heroes[j].Hero == hero {
-					player.Heroes[j].TimeSpentInSeconds += 5
-					player.Heroes[j] = addHeroStats(player.Heroes[j], stats)
-					found = true
-					break
-				}
+		if i < len(stats.Ranks) {
+			rank = fmt.Sprintf(" - %d/%d", stats.Ranks[i].Rank, stats.Ranks[i].OutOf)
+			if stats.Role != "" {
+				rank += " among " + roleMembers(stats.Role)
 			}
-			if !found {
-				player.Heroes = append(player.Heroes, HeroStats{Hero: hero, TimeSpentInSeconds: 0})
+			if stats.Ranks[i].Unranked {
+				rank = " - unranked"
 			}
-
-			prevLines[index] = line
-
-			return player, prevLines
 		}
-	}
-	return player, prevLines
-}
-
-func addHeroStats(playerHero HeroStats, stats [10]float64) HeroStats {
 
-	playerHero.DamageDealt += stats[0]
-	playerHero.DamageTaken += stats[1]
-	playerHero.Deaths += stats[2]
-	playerHero.FinalBlows += stats[3]
-	playerHero.Eliminations += stats[4]
-	playerHero.SoloKills += stats[5]
-	playerHero.HealingDealt += stats[6]
-	playerHero.EnvironmentalKills += stats[7]
-	playerHero.OffensiveAssists += stats[8]
-	playerHero.UltsUsed += stats[9]
-
-	return playerHero
-
-}
-
-func subtractStats(newLine string, oldLine string) [10]float64 {
-
-	newStats := stringStatsToFloatStats(strings.Split(newLine, ","))
-	oldStats := stringStatsToFloatStats(strings.Split(oldLine, ","))
-
-	for i := 0; i < 10; i++ {
-		newStats[i] = newStats[i] - oldStats[i]
+		message += fmt.Sprintf("%s: %.2f%s\n", labels[i], values[i], rank)
 	}
 
-	return newStats
-}
-
-func stringStatsToFloatStats(stringStats []string) [10]float64 {
+	message += "\nAll Stats per 10 minutes"
 
-	var floatStats [10]float64
-
-	for i := 3; i <= 12; i++ {
-		floatStats[i-3], _ = strconv.ParseFloat(stringStats[i], 64)
+	if len(stats.Stints) > 1 {
+		message += "\n\n" + formatStintsMessage(stats.Stints)
 	}
 
-	return floatStats
-}
-
-func getCurrentSeconds(line string) int {
-
-	timeString := strings.Split(line, " ")[0]
-	timeString = strings.ReplaceAll(timeString, "[", "")
-	timeString = strings.ReplaceAll(timeString, "]", "")
-	timeArray := strings.Split(timeString, ":")
-
-	minutes, _ := strconv.Atoi(timeArray[1])
-	seconds, _ := strconv.Atoi(timeArray[2])
-
-	return minutes*60 + seconds
+	return message
 }
 
+// capitalizeFirstLetterOfEachWord is the fallback spelling of names stored in
+// lowercase. Team names that need more than this get a display name.
 func capitalizeFirstLetterOfEachWord(str string) string {
 
-	var outStr string
-
-	strArr := strings.Split(str, " ")
+	words := strings.Fields(str)
 
-	for i := 0; i < len(strArr); i++ {
-		firstChar := unicode.ToUpper(rune(strArr[i][0]))
-		outStr += string(firstChar) + strArr[i][1:] + " "
+	for i, word := range words {
+		first, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToUpper(first)) + word[size:]
 	}
 
-	return strings.Trim(outStr, " ")
+	return strings.Join(words, " ")
 
 }
 
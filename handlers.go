@@ -1,65 +1,111 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func Handler(c *gin.Context) {
+func CreateMatchHandler(c *gin.Context) {
+	matchID, err := CreateMatch(c)
+	respond(c, gin.H{"matchID": matchID, "message": fmt.Sprintf("%d", matchID)}, err, nil)
+}
 
-	if strings.HasPrefix(c.Request.URL.Path, "/createMatch") {
-		response := CreateMatch(c)
-		c.JSON(http.StatusOK, gin.H{"message": response})
-		return
-	}
+func UploadMapHandler(c *gin.Context) {
+	result, err := UploadMap(c)
+	respond(c, result, err, nil)
+}
 
-	if strings.HasPrefix(c.Request.URL.Path, "/uploadMap") {
-		response := UploadMap(c)
-		c.JSON(http.StatusOK, gin.H{"message": response})
-		return
-	}
+func PlayerStatsHandler(c *gin.Context) {
+	stats, err := PStats(c)
+	respond(c, stats, err, func() string { return formatPlayerStatsMessage(stats) })
+}
 
-	if strings.HasPrefix(c.Request.URL.Path, "/pStats") {
-		response := PStats(c)
-		c.JSON(http.StatusOK, gin.H{"message": response})
-		return
-	}
+func PlayerHeroStatsHandler(c *gin.Context) {
+	stats, err := PStatsHero(c)
+	respond(c, stats, err, func() string { return formatPlayerStatsMessage(stats) })
+}
 
-	if strings.HasPrefix(c.Request.URL.Path, "/hStats") {
-		response := PStatsHero(c)
-		c.JSON(http.StatusOK, gin.H{"message": response})
-		return
+func PlayerRoleStatsHandler(c *gin.Context) {
+	stats, err := PStatsRole(c)
+	respond(c, stats, err, func() string { return formatPlayerStatsMessage(stats) })
+}
+
+func TeamStatsHandler(c *gin.Context) {
+	stats, err := TStats(c)
+	respond(c, stats, err, func() string { return formatTeamStatsMessage(stats) })
+}
+
+func TeamMapStatsHandler(c *gin.Context) {
+	stats, err := TStatsMap(c)
+	respond(c, stats, err, func() string { return formatTeamStatsMessage(stats) })
+}
+
+func CompareStatsHandler(c *gin.Context) {
+	comparison, err := CompareStats(c)
+	respond(c, comparison, err, func() string { return formatCompareMessage(comparison) })
+}
+
+func UpdateLeaderboardsHandler(c *gin.Context) {
+	message, err := UpdateLeaderboards(c)
+	respond(c, gin.H{"message": message}, err, nil)
+}
+
+func NotFoundHandler(c *gin.Context) {
+	respond(c, nil, errNotFound("endpoint_not_found", "Endpoint not found"), nil)
+}
+
+// deprecated marks a pre-REST route that is kept as an alias for one season.
+// Responses point clients at the route that replaces it.
+func deprecated(successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		c.Next()
 	}
+}
 
-	if strings.HasPrefix(c.Request.URL.Path, "/tStats") {
-		response := TStats(c)
-		c.JSON(http.StatusOK, gin.H{"message": response})
-		return
+// requestValue looks a value up in the route parameters first, then in the
+// form body and finally in the query string, so the REST routes and the
+// deprecated query-string aliases can share one implementation.
+func requestValue(c *gin.Context, key string) string {
+
+	if value := c.Param(key); value != "" {
+		return value
 	}
 
-	if strings.HasPrefix(c.Request.URL.Path, "/tmStats") {
-		response := TStatsMap(c)
-		c.JSON(http.StatusOK, gin.H{"message": response})
-		return
+	if value := c.PostForm(key); value != "" {
+		return value
 	}
 
-	if strings.HasPrefix(c.Request.URL.Path, "/compareStats") {
-		response := CompareStats(c)
-		c.JSON(http.StatusOK, gin.H{"message": response})
+	return c.Query(key)
+}
+
+// respond writes the structured result of an endpoint. Callers that pass
+// format=text get the Discord-style rendering from text instead. Errors that
+// aren't an *APIError are reported as internal server errors.
+func respond(c *gin.Context, data any, err error, text func() string) {
+
+	if err != nil {
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			apiErr = &APIError{Status: http.StatusInternalServerError, Code: "internal_error", Message: "Internal server error", Err: err}
+		}
+
+		if apiErr.Err != nil {
+			fmt.Println(apiErr.Err, c.Request.URL.Path)
+		}
+
+		c.JSON(apiErr.Status, gin.H{"error": apiErr})
 		return
 	}
 
-	if strings.HasPrefix(c.Request.URL.Path, "/updateLeaderboards") {
-		response := UpdateLeaderboards()
-		c.JSON(http.StatusOK, gin.H{"message": response})
+	if text != nil && c.Query("format") == "text" {
+		c.JSON(http.StatusOK, gin.H{"message": text()})
 		return
 	}
 
-	// Return a 404 Not Found error for unknown endpoints
-	c.JSON(http.StatusNotFound, gin.H{
-		"error": "Endpoint not found",
-	})
-
+	c.JSON(http.StatusOK, data)
 }
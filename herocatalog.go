@@ -0,0 +1,208 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeroCatalogEntry is a hero that can show up in a Workshop log. Name is the
+// canonical name stored in the database, Aliases are the other spellings
+// uploaders and players commonly use.
+type HeroCatalogEntry struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"displayName"`
+	Role        string   `json:"role"`
+	Aliases     []string `json:"aliases,omitempty"`
+}
+
+// heroCatalogFile lists every hero, so a new hero is a new entry there rather
+// than a code change.
+const heroCatalogFile = "heroes.json"
+
+// heroCatalog is loaded once on startup and only read afterwards. Its order is
+// the order of hero leaderboards and role sums.
+var heroCatalog []HeroCatalogEntry
+
+// roles are what heroes are grouped into for role leaderboards and stats.
+var roles = []string{"tank", "damage", "support"}
+
+func HeroCatalogHandler(c *gin.Context) {
+	respond(c, heroCatalog, nil, nil)
+}
+
+// loadHeroCatalog reads heroes.json and checks that every hero has a role and
+// that no two heroes can be spelled the same way.
+func loadHeroCatalog() error {
+
+	var catalog []HeroCatalogEntry
+
+	contents, err := os.ReadFile(heroCatalogFile)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(contents, &catalog)
+	if err != nil {
+		return fmt.Errorf("loadHeroCatalog(): %w", err)
+	}
+
+	spellings := make(map[string]string)
+
+	for i, entry := range catalog {
+
+		entry.Name = strings.ToLower(strings.TrimSpace(entry.Name))
+		if entry.Name == "" {
+			return fmt.Errorf("loadHeroCatalog(): hero %d has no name", i+1)
+		}
+		if _, taken := spellings[heroNameKey(entry.Name)]; taken {
+			return fmt.Errorf("loadHeroCatalog(): %s is listed more than once", entry.Name)
+		}
+
+		if findIndexInSlice(roles, entry.Role) == -1 {
+			return fmt.Errorf("loadHeroCatalog(): %s should be one of %s, not %q", entry.Name, strings.Join(roles, ", "), entry.Role)
+		}
+
+		if entry.DisplayName == "" {
+			entry.DisplayName = capitalizeFirstLetterOfEachWord(entry.Name)
+		}
+
+		for _, spelling := range append([]string{entry.Name}, entry.Aliases...) {
+			key := heroNameKey(spelling)
+			if hero, taken := spellings[key]; taken && hero != entry.Name {
+				return fmt.Errorf("loadHeroCatalog(): %q could be %s or %s", spelling, hero, entry.Name)
+			}
+			spellings[key] = entry.Name
+		}
+
+		catalog[i] = entry
+	}
+
+	heroCatalog = catalog
+
+	return nil
+}
+
+// resolveHeroName returns the canonical name for any spelling of a hero in the
+// catalog. Case, spaces, underscores and punctuation are ignored.
+func resolveHeroName(name string) (string, bool) {
+
+	key := heroNameKey(name)
+
+	for _, entry := range heroCatalog {
+		if heroNameKey(entry.Name) == key {
+			return entry.Name, true
+		}
+		for _, alias := range entry.Aliases {
+			if heroNameKey(alias) == key {
+				return entry.Name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func heroNameKey(name string) string {
+
+	name = strings.ToLower(name)
+
+	return strings.NewReplacer("_", "", " ", "", ".", "", ":", "", "'", "", "’", "", "-", "").Replace(name)
+}
+
+func heroDisplayName(hero string) string {
+
+	for _, entry := range heroCatalog {
+		if entry.Name == hero {
+			return entry.DisplayName
+		}
+	}
+
+	return capitalizeFirstLetterOfEachWord(hero)
+}
+
+// roleHeroes returns the heroes of a role in catalog order.
+func roleHeroes(role string) []string {
+
+	var heroes []string
+
+	for _, entry := range heroCatalog {
+		if entry.Role == role {
+			heroes = append(heroes, entry.Name)
+		}
+	}
+
+	return heroes
+}
+
+func handleWeirdRoleNames(role string) string {
+
+	if role == "tanks" {
+		return "tank"
+	}
+	if role == "dps" || role == "dmg" {
+		return "damage"
+	}
+	if role == "supports" || role == "healer" || role == "healers" || role == "supp" {
+		return "support"
+	}
+
+	return role
+}
+
+// roleMembers is how players of a role are referred to, as in "3/24 among
+// supports".
+func roleMembers(role string) string {
+
+	if role == "damage" {
+		return "damage players"
+	}
+
+	return role + "s"
+}
+
+// normalizeHeroNames rewrites hero names stored under a spelling that is now an
+// alias, so a hero can be renamed in the catalog by keeping the old name as an
+// alias.
+func normalizeHeroNames(db *sql.DB) error {
+
+	var names []string
+
+	rows, err := db.Query("SELECT DISTINCT hero FROM mapPlayerHero")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		canonical, found := resolveHeroName(name)
+		if !found || canonical == name {
+			continue
+		}
+
+		for _, table := range []string{"mapPlayerHero", "mapTimeline", "leaderboardEntry"} {
+			_, err := db.Exec(fmt.Sprintf("UPDATE %s SET hero = ? WHERE hero = ?", table), canonical, name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func LeaderboardHandler(c *gin.Context) {
+	leaderboard, err := GetLeaderboard(c)
+	respond(c, leaderboard, err, func() string { return formatLeaderboardMessage(leaderboard) })
+}
+
+// GetLeaderboard returns the top players by a stat per 10 minutes, over all
+// heroes, on the hero given or over the heroes of a role, for all of history
+// or a season.
+func GetLeaderboard(c *gin.Context) (Leaderboard, error) {
+
+	var leaderboard Leaderboard
+
+	leaderboard.Stat = requestValue(c, "stat")
+	if findIndexInSlice(statNames, leaderboard.Stat) == -1 {
+		return leaderboard, errBadRequest("unknown_stat", fmt.Sprintf("Unknown stat %s, expected one of %s", leaderboard.Stat, strings.Join(statNames, ", ")))
+	}
+
+	if hero := c.Query("hero"); hero != "" {
+		canonical, found := resolveHeroName(hero)
+		if !found {
+			return leaderboard, errBadRequest("unknown_hero", fmt.Sprintf("Unknown hero %s", hero))
+		}
+		leaderboard.Hero = canonical
+	}
+
+	if role := c.Query("role"); role != "" {
+		if leaderboard.Hero != "" {
+			return leaderboard, errBadRequest("invalid_parameters", "A leaderboard is either for a hero or for a role")
+		}
+		leaderboard.Role = handleWeirdRoleNames(strings.ToLower(role))
+		if findIndexInSlice(roles, leaderboard.Role) == -1 {
+			return leaderboard, errBadRequest("unknown_role", fmt.Sprintf("Unknown role %s, expected one of %s", role, strings.Join(roles, ", ")))
+		}
+	}
+
+	season, err := seasonParam(c)
+	if err != nil {
+		return leaderboard, err
+	}
+	leaderboard.Season = season
+
+	limit, err := limitParam(c)
+	if err != nil {
+		return leaderboard, err
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	config, err := loadLeaderboardConfig()
+	if err != nil {
+		return leaderboard, errInternal(err, "Error loading the leaderboard config")
+	}
+	leaderboard.Ascending = config.StatDirections[leaderboard.Stat] == "ascending"
+
+	leaderboard, err = getLeaderboard(leaderboard, limit, db)
+	if err != nil {
+		return leaderboard, errInternal(err, "Internal server error")
+	}
+
+	return leaderboard, nil
+}
+
+// configFile is the config shared with the bot.
+const configFile = "config.json"
+
+// Leaderboard scopes that can have their own eligibility thresholds.
+const (
+	overallScope = "overall"
+	heroScope    = "hero"
+	roleScope    = "role"
+)
+
+// defaultLeaderboardConfig applies to anything config.json leaves out. Fewer
+// deaths and less damage taken are better, everything else ranks highest
+// first.
+var defaultLeaderboardConfig = LeaderboardConfig{
+	MinPlaytimeSeconds: map[string]int{overallScope: 1800, heroScope: 600, roleScope: 1800},
+	MinMaps:            map[string]int{overallScope: 0, heroScope: 0, roleScope: 0},
+	StatDirections:     map[string]string{"damageTaken": "ascending", "deaths": "ascending"},
+}
+
+// loadLeaderboardConfig reads the "leaderboards" section of config.json, which
+// is shared with the bot, on top of the defaults.
+func loadLeaderboardConfig() (LeaderboardConfig, error) {
+
+	var file struct {
+		Leaderboards LeaderboardConfig `json:"leaderboards"`
+	}
+
+	config := LeaderboardConfig{MinPlaytimeSeconds: map[string]int{}, MinMaps: map[string]int{}, StatDirections: map[string]string{}}
+
+	for scope, seconds := range defaultLeaderboardConfig.MinPlaytimeSeconds {
+		config.MinPlaytimeSeconds[scope] = seconds
+	}
+	for scope, maps := range defaultLeaderboardConfig.MinMaps {
+		config.MinMaps[scope] = maps
+	}
+	for stat, direction := range defaultLeaderboardConfig.StatDirections {
+		config.StatDirections[stat] = direction
+	}
+
+	contents, err := os.ReadFile(configFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+
+	err = json.Unmarshal(contents, &file)
+	if err != nil {
+		return config, fmt.Errorf("loadLeaderboardConfig(): %w", err)
+	}
+
+	for scope, seconds := range file.Leaderboards.MinPlaytimeSeconds {
+		config.MinPlaytimeSeconds[scope] = seconds
+	}
+	for scope, maps := range file.Leaderboards.MinMaps {
+		config.MinMaps[scope] = maps
+	}
+	for stat, direction := range file.Leaderboards.StatDirections {
+		if findIndexInSlice(statNames, stat) == -1 {
+			return config, fmt.Errorf("loadLeaderboardConfig(): unknown stat %s", stat)
+		}
+		if direction != "ascending" && direction != "descending" {
+			return config, fmt.Errorf("loadLeaderboardConfig(): %s should be ascending or descending, not %s", stat, direction)
+		}
+		config.StatDirections[stat] = direction
+	}
+
+	return config, nil
+}
+
+// key is the config as it's stored with the leaderboards built with it.
+func (config LeaderboardConfig) key() (string, error) {
+
+	contents, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("LeaderboardConfig.key(): %w", err)
+	}
+
+	return string(contents), nil
+}
+
+func (config LeaderboardConfig) ascendingStats() []any {
+
+	var stats []any
+
+	for _, stat := range statNames {
+		if config.StatDirections[stat] == "ascending" {
+			stats = append(stats, stat)
+		}
+	}
+
+	return stats
+}
+
+// refreshLeaderboards updates the all-time leaderboards and those of the
+// match's season after players' maps in the match changed.
+func refreshLeaderboards(matchID int, players []string, db queryer) error {
+
+	var season int
+
+	err := db.QueryRow("SELECT seasonID FROM game WHERE ID = ?", matchID).Scan(&season)
+	if err != nil {
+		return fmt.Errorf("refreshLeaderboards(): %w", err)
+	}
+
+	computedAt := formatTime(time.Now())
+
+	for _, scope := range []int{0, season} {
+		err := updateLeaderboards(scope, players, computedAt, db)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// refreshBuiltLeaderboards updates players on every season's leaderboards that
+// has been built, for changes that aren't tied to one match.
+func refreshBuiltLeaderboards(players []string, db queryer) error {
+
+	var seasons []int
+
+	rows, err := db.Query("SELECT DISTINCT seasonID FROM leaderboardEntry")
+	if err != nil {
+		return fmt.Errorf("refreshBuiltLeaderboards(): %w", err)
+	}
+
+	for rows.Next() {
+		var season int
+		if err := rows.Scan(&season); err != nil {
+			rows.Close()
+			return fmt.Errorf("refreshBuiltLeaderboards(): %w", err)
+		}
+		seasons = append(seasons, season)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("refreshBuiltLeaderboards(): %w", err)
+	}
+
+	computedAt := formatTime(time.Now())
+
+	for _, season := range seasons {
+		err := updateLeaderboards(season, players, computedAt, db)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rebuildOutdatedLeaderboards rebuilds every season's leaderboards that were
+// built with other thresholds or stat directions than config.json has now.
+func rebuildOutdatedLeaderboards(db *sql.DB) error {
+
+	var seasons []int
+
+	config, err := loadLeaderboardConfig()
+	if err != nil {
+		return err
+	}
+
+	key, err := config.key()
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT DISTINCT seasonID FROM leaderboardEntry WHERE seasonID NOT IN (SELECT seasonID FROM leaderboardBuild WHERE config = ?)", key)
+	if err != nil {
+		return fmt.Errorf("rebuildOutdatedLeaderboards(): %w", err)
+	}
+
+	for rows.Next() {
+		var season int
+		if err := rows.Scan(&season); err != nil {
+			rows.Close()
+			return fmt.Errorf("rebuildOutdatedLeaderboards(): %w", err)
+		}
+		seasons = append(seasons, season)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("rebuildOutdatedLeaderboards(): %w", err)
+	}
+
+	if len(seasons) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("rebuildOutdatedLeaderboards(): %w", err)
+	}
+	defer tx.Rollback()
+
+	computedAt := formatTime(time.Now())
+
+	for _, season := range seasons {
+		err := updateLeaderboards(season, nil, computedAt, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// updateLeaderboards recomputes the entries of players on a season's
+// leaderboards, 0 being all of history, and reranks the leaderboards they were
+// or now are on. No players means everyone. Totals are summed per player and
+// hero or role in the database, so this is a handful of queries however many
+// players there are. Players below the playtime or map thresholds are kept
+// with rank 0, so they can be shown as unranked. Leaderboards that were built
+// with other thresholds or stat directions are rebuilt for everyone.
+func updateLeaderboards(season int, players []string, computedAt string, db queryer) error {
+
+	var builtWith string
+
+	if players != nil && len(players) == 0 {
+		return nil
+	}
+
+	config, err := loadLeaderboardConfig()
+	if err != nil {
+		return err
+	}
+
+	key, err := config.key()
+	if err != nil {
+		return err
+	}
+
+	err = db.QueryRow("SELECT config FROM leaderboardBuild WHERE seasonID = ?", season).Scan(&builtWith)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("updateLeaderboards(): %w", err)
+	}
+	if builtWith != key {
+		players = nil
+	}
+
+	scope, scopeArgs := "", []any{}
+
+	if players != nil {
+		scope = " AND player IN (?" + strings.Repeat(", ?", len(players)-1) + ")"
+		for _, player := range players {
+			scopeArgs = append(scopeArgs, player)
+		}
+	}
+
+	boards, err := leaderboardBoards(season, scope, scopeArgs, db)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("DELETE FROM leaderboardEntry WHERE seasonID = ?"+scope, append([]any{season}, scopeArgs...)...)
+	if err != nil {
+		return fmt.Errorf("updateLeaderboards(): %w", err)
+	}
+
+	filter := StatsFilter{Season: season}
+
+	// Role leaderboards sum up a player's heroes of each role
+	var heroRoleRows []string
+	var heroRoleArgs []any
+
+	for _, entry := range heroCatalog {
+		heroRoleRows = append(heroRoleRows, "(?, ?)")
+		heroRoleArgs = append(heroRoleArgs, entry.Name, entry.Role)
+	}
+
+	sources := []struct {
+		leaderboardScope string
+		table            string
+		from             string
+		role             string
+		hero             string
+		groupBy          string
+	}{
+		{overallScope, "mapPlayer", "mapPlayer", "''", "''", "player"},
+		{heroScope, "mapPlayerHero", "mapPlayerHero", "''", "mapPlayerHero.hero", "player, mapPlayerHero.hero"},
+		{roleScope, "mapPlayerHero", "mapPlayerHero JOIN heroRole ON heroRole.hero = mapPlayerHero.hero", "heroRole.role", "''", "player, heroRole.role"},
+	}
+
+	for _, source := range sources {
+
+		var sums, values []string
+
+		for _, stat := range statNames {
+			sums = append(sums, fmt.Sprintf("SUM(%s) AS %s", stat, stat))
+			values = append(values, fmt.Sprintf("SELECT ?, '%s', role, hero, player, %s * 600.0 / duration, ranked, ? FROM totals", stat, stat))
+		}
+
+		condition, filterArgs := filter.sql(source.table)
+
+		query := fmt.Sprintf(`WITH heroRole (hero, role) AS (VALUES %s),
+		totals AS (
+			SELECT player, %s AS role, %s AS hero, %s, SUM(durationInSeconds) AS duration,
+			SUM(durationInSeconds) >= ? AND COUNT(DISTINCT mapID) >= ? AS ranked
+			FROM %s
+			WHERE 1 = 1%s%s
+			GROUP BY %s
+			HAVING SUM(durationInSeconds) > 0
+		)
+		INSERT INTO leaderboardEntry (seasonID, stat, role, hero, player, value, rank, computedAt) %s`, strings.Join(heroRoleRows, ", "), source.role, source.hero, strings.Join(sums, ", "), source.from, scope, condition, source.groupBy, strings.Join(values, " UNION ALL "))
+
+		args := append(append(append(append([]any{}, heroRoleArgs...), config.MinPlaytimeSeconds[source.leaderboardScope], config.MinMaps[source.leaderboardScope]), scopeArgs...), filterArgs...)
+		for range statNames {
+			args = append(args, season, computedAt)
+		}
+
+		_, err := db.Exec(query, args...)
+		if err != nil {
+			return fmt.Errorf("updateLeaderboards(): %w", err)
+		}
+	}
+
+	after, err := leaderboardBoards(season, scope, scopeArgs, db)
+	if err != nil {
+		return err
+	}
+
+	before := make(map[leaderboardBoard]bool)
+	for _, board := range boards {
+		before[board] = true
+	}
+
+	for _, board := range after {
+		if !before[board] {
+			boards = append(boards, board)
+		}
+	}
+
+	err = rankLeaderboards(season, boards, config.ascendingStats(), db)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("INSERT INTO leaderboardBuild (seasonID, config) VALUES (?, ?) ON CONFLICT (seasonID) DO UPDATE SET config = excluded.config", season, key)
+	if err != nil {
+		return fmt.Errorf("updateLeaderboards(): %w", err)
+	}
+
+	return nil
+}
+
+// leaderboardBoard identifies one leaderboard of a stat within a season. The
+// one over all heroes has neither a role nor a hero.
+type leaderboardBoard struct {
+	role string
+	hero string
+}
+
+// leaderboardBoards returns the leaderboards players are on.
+func leaderboardBoards(season int, scope string, scopeArgs []any, db queryer) ([]leaderboardBoard, error) {
+
+	var boards []leaderboardBoard
+
+	rows, err := db.Query("SELECT DISTINCT role, hero FROM leaderboardEntry WHERE seasonID = ?"+scope, append([]any{season}, scopeArgs...)...)
+	if err != nil {
+		return boards, fmt.Errorf("leaderboardBoards(): %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var board leaderboardBoard
+		if err := rows.Scan(&board.role, &board.hero); err != nil {
+			return boards, fmt.Errorf("leaderboardBoards(): %w", err)
+		}
+		boards = append(boards, board)
+	}
+
+	return boards, rows.Err()
+}
+
+// rankLeaderboards renumbers the given leaderboards of a season, lowest value
+// first for ascending stats. Players with the same value share a rank. Entries
+// are inserted with rank 1 if the player is eligible and 0 if not, and only
+// eligible players are ranked.
+func rankLeaderboards(season int, boards []leaderboardBoard, ascending []any, db queryer) error {
+
+	// An empty IN list is valid SQL but can't be written with placeholders
+	ascendingList := "''"
+	if len(ascending) > 0 {
+		ascendingList = "?" + strings.Repeat(", ?", len(ascending)-1)
+	}
+
+	query := fmt.Sprintf(`UPDATE leaderboardEntry SET rank = 1 + (
+		SELECT COUNT(*) FROM leaderboardEntry better
+		WHERE better.seasonID = leaderboardEntry.seasonID AND better.stat = leaderboardEntry.stat AND better.role = leaderboardEntry.role AND better.hero = leaderboardEntry.hero
+		AND better.rank > 0 AND CASE WHEN leaderboardEntry.stat IN (%s) THEN better.value < leaderboardEntry.value ELSE better.value > leaderboardEntry.value END
+	)
+	WHERE seasonID = ? AND role = ? AND hero = ? AND rank > 0`, ascendingList)
+
+	for _, board := range boards {
+		_, err := db.Exec(query, append(append([]any{}, ascending...), season, board.role, board.hero)...)
+		if err != nil {
+			return fmt.Errorf("rankLeaderboards(): %w", err)
+		}
+	}
+
+	return nil
+}
+
+// getLeaderboard returns the top ranked players of a leaderboard, followed by
+// every player that is unranked for being below the thresholds.
+func getLeaderboard(leaderboard Leaderboard, limit int, db queryer) (Leaderboard, error) {
+
+	rows, err := db.Query(`SELECT * FROM (SELECT rank, player, value, computedAt FROM leaderboardEntry WHERE seasonID = ? AND stat = ? AND role = ? AND hero = ? AND rank > 0 ORDER BY rank, player LIMIT ?)
+	UNION ALL
+	SELECT * FROM (SELECT rank, player, value, computedAt FROM leaderboardEntry WHERE seasonID = ? AND stat = ? AND role = ? AND hero = ? AND rank = 0 ORDER BY player)`,
+		leaderboard.Season, leaderboard.Stat, leaderboard.Role, leaderboard.Hero, limit, leaderboard.Season, leaderboard.Stat, leaderboard.Role, leaderboard.Hero)
+	if err != nil {
+		return leaderboard, fmt.Errorf("getLeaderboard(): %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			entry      LeaderboardEntry
+			computedAt sql.NullString
+		)
+
+		if err := rows.Scan(&entry.Rank, &entry.Player, &entry.Value, &computedAt); err != nil {
+			return leaderboard, fmt.Errorf("getLeaderboard(): %w", err)
+		}
+		entry.Unranked = entry.Rank == 0
+
+		leaderboard.ComputedAt, err = parseStoredTime(computedAt)
+		if err != nil {
+			return leaderboard, fmt.Errorf("getLeaderboard(): %w", err)
+		}
+
+		leaderboard.Entries = append(leaderboard.Entries, entry)
+	}
+
+	return leaderboard, rows.Err()
+}
+
+// getPlayerRanks returns a player's rank on every stat leaderboard of a role
+// or a hero, or over all heroes if both are empty. Leaderboards that haven't
+// been built yet leave the player without ranks.
+func getPlayerRanks(player string, role string, hero string, season int, db queryer) ([]StatRank, error) {
+
+	var ranks []StatRank
+
+	rows, err := db.Query("SELECT stat, COUNT(CASE WHEN rank > 0 THEN 1 END), COALESCE(MAX(CASE WHEN player = ? THEN rank END), 0) FROM leaderboardEntry WHERE seasonID = ? AND role = ? AND hero = ? GROUP BY stat", player, season, role, hero)
+	if err != nil {
+		return ranks, fmt.Errorf("getPlayerRanks(): %w", err)
+	}
+	defer rows.Close()
+
+	found := make(map[string]StatRank)
+
+	for rows.Next() {
+		var rank StatRank
+		if err := rows.Scan(&rank.Stat, &rank.OutOf, &rank.Rank); err != nil {
+			return ranks, fmt.Errorf("getPlayerRanks(): %w", err)
+		}
+		rank.Unranked = rank.Rank == 0
+		found[rank.Stat] = rank
+	}
+
+	if err = rows.Err(); err != nil {
+		return ranks, fmt.Errorf("getPlayerRanks(): %w", err)
+	}
+
+	if len(found) == 0 {
+		return ranks, nil
+	}
+
+	for _, stat := range statNames {
+		rank, ok := found[stat]
+		if !ok {
+			rank = StatRank{Stat: stat, Unranked: true}
+		}
+		ranks = append(ranks, rank)
+	}
+
+	return ranks, nil
+}
+
+func formatLeaderboardMessage(leaderboard Leaderboard) string {
+
+	title := leaderboard.Stat
+	if leaderboard.Hero != "" {
+		title += " on " + heroDisplayName(leaderboard.Hero)
+	}
+	if leaderboard.Role != "" {
+		title += " among " + roleMembers(leaderboard.Role)
+	}
+	if leaderboard.Season != 0 {
+		title += fmt.Sprintf(", season %d", leaderboard.Season)
+	}
+
+	if len(leaderboard.Entries) == 0 {
+		return fmt.Sprintf("No one is ranked for %s yet", title)
+	}
+
+	order := "Top"
+	if leaderboard.Ascending {
+		order = "Lowest"
+	}
+
+	message := fmt.Sprintf("%s %s per 10 minutes:\n", order, title)
+
+	unranked := false
+
+	for _, entry := range leaderboard.Entries {
+		if entry.Unranked && !unranked {
+			message += "Unranked, below the playtime or map thresholds:\n"
+			unranked = true
+		}
+		if entry.Unranked {
+			message += fmt.Sprintf("- %s: %.2f\n", entry.Player, entry.Value)
+			continue
+		}
+		message += fmt.Sprintf("%d. %s: %.2f\n", entry.Rank, entry.Player, entry.Value)
+	}
+
+	return message
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestFormatLeaderboardMessage(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		leaderboard Leaderboard
+		want        string
+	}{
+		{
+			name:        "empty",
+			leaderboard: Leaderboard{Stat: "deaths", Season: 2},
+			want:        "No one is ranked for deaths, season 2 yet",
+		},
+		{
+			name: "ranked and unranked players",
+			leaderboard: Leaderboard{Stat: "damageDealt", Entries: []LeaderboardEntry{
+				{Rank: 1, Player: "p1", Value: 9000},
+				{Rank: 1, Player: "p2", Value: 9000},
+				{Rank: 3, Player: "p3", Value: 8000.5},
+				{Player: "p4", Value: 12000, Unranked: true},
+			}},
+			want: "Top damageDealt per 10 minutes:\n1. p1: 9000.00\n1. p2: 9000.00\n3. p3: 8000.50\nUnranked, below the playtime or map thresholds:\n- p4: 12000.00\n",
+		},
+		{
+			name: "only unranked players",
+			leaderboard: Leaderboard{Stat: "deaths", Ascending: true, Entries: []LeaderboardEntry{
+				{Player: "p1", Value: 4, Unranked: true},
+			}},
+			want: "Lowest deaths per 10 minutes:\nUnranked, below the playtime or map thresholds:\n- p1: 4.00\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := formatLeaderboardMessage(test.leaderboard); got != test.want {
+				t.Errorf("formatLeaderboardMessage() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import(
+	"fmt"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -9,16 +11,88 @@ import(
 
 func main() {
 
+	err := loadHeroCatalog()
+	if err != nil {
+		panic(fmt.Sprintf("%q: loading the hero catalog\n", err))
+	}
+
 	CreateDatabase()
 
+	adminToken, err := loadAdminToken()
+	if err != nil {
+		panic(fmt.Sprintf("%q: loading the admin token\n", err))
+	}
+
 	r := gin.Default()
 
 	r.Use(cors.Default())
 
-	// Define API endpoint
-	r.GET("*any", Handler)
+	// Routes that change or delete data are registered on admin, see requireAdmin
+	admin := r.Group("/", requireAdmin(adminToken))
+
+	// Define API endpoints
+	r.GET("/seasons", SeasonsHandler)
+	admin.POST("/seasons", CreateSeasonHandler)
+
+	r.GET("/divisions", DivisionsHandler)
+	admin.POST("/divisions", CreateDivisionHandler)
+	r.GET("/divisions/:divisionID/standings", StandingsHandler)
+	r.GET("/pots", PotsHandler)
+	admin.PUT("/pots/:pot", SeedPotHandler)
+	admin.POST("/draws", GroupDrawHandler)
+	r.GET("/brackets", BracketsHandler)
+	admin.POST("/brackets", CreateBracketHandler)
+	r.GET("/brackets/:bracketID", BracketHandler)
+
+	admin.POST("/matches", CreateMatchHandler)
+	r.GET("/matches/:matchID", MatchHandler)
+	admin.PATCH("/matches/:matchID", ScheduleMatchHandler)
+	admin.DELETE("/matches/:matchID", DeleteMatchHandler)
+	admin.POST("/matches/:matchID/maps", UploadMapHandler)
+	r.GET("/maps", MapCatalogHandler)
+	r.GET("/heroes", HeroCatalogHandler)
+	admin.PATCH("/maps/:mapID", AmendMapHandler)
+	admin.DELETE("/maps/:mapID", DeleteMapHandler)
+	r.GET("/maps/:mapID/timeline", MapTimelineHandler)
+
+	r.GET("/players/:player", PlayerStatsHandler)
+	r.GET("/players/:player/heroes/:hero", PlayerHeroStatsHandler)
+	r.GET("/players/:player/roles/:role", PlayerRoleStatsHandler)
+	r.GET("/players/:player/profile", PlayerProfileHandler)
+	admin.POST("/players/:player/aliases", AddPlayerAliasHandler)
+	admin.DELETE("/players/:player/aliases/:alias", RemovePlayerAliasHandler)
+	admin.PUT("/players/:player/discord", LinkDiscordHandler)
+	r.GET("/comparisons", CompareStatsHandler)
+
+	r.GET("/teams", TeamsHandler)
+	r.GET("/teams/:team", TeamStatsHandler)
+	admin.PATCH("/teams/:team", UpdateTeamHandler)
+	admin.POST("/teams/:team/merge", MergeTeamHandler)
+	r.GET("/teams/:team/maps/:map", TeamMapStatsHandler)
+	r.GET("/teams/:team/calendar.ics", TeamCalendarHandler)
+	r.GET("/teams/:team/roster", RosterHandler)
+
+	r.GET("/schedule/upcoming", UpcomingMatchesHandler)
+	r.GET("/schedule/today", TodaysMatchesHandler)
+	r.GET("/results/recent", RecentResultsHandler)
+
+	r.GET("/leaderboards/:stat", LeaderboardHandler)
+	admin.POST("/leaderboards/rebuild", UpdateLeaderboardsHandler)
+
+	// Deprecated aliases for the old query string API, kept for one season
+	admin.GET("/createMatch", deprecated("/matches"), CreateMatchHandler)
+	admin.GET("/uploadMap", deprecated("/matches/:matchID/maps"), UploadMapHandler)
+	admin.POST("/uploadMap", deprecated("/matches/:matchID/maps"), UploadMapHandler)
+	r.GET("/pStats", deprecated("/players/:player"), PlayerStatsHandler)
+	r.GET("/hStats", deprecated("/players/:player/heroes/:hero"), PlayerHeroStatsHandler)
+	r.GET("/tStats", deprecated("/teams/:team"), TeamStatsHandler)
+	r.GET("/tmStats", deprecated("/teams/:team/maps/:map"), TeamMapStatsHandler)
+	r.GET("/compareStats", deprecated("/comparisons"), CompareStatsHandler)
+	admin.GET("/updateLeaderboards", deprecated("/leaderboards/rebuild"), UpdateLeaderboardsHandler)
+
+	r.NoRoute(NotFoundHandler)
 
 	// Start Gin server
 	r.Run(":8080")
 	
-}
\ No newline at end of file
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MapCatalogEntry is a map that can be played in Saltwater Showdown. Name is the
+// canonical name stored in the database, Aliases are the other spellings
+// uploaders and players commonly use.
+type MapCatalogEntry struct {
+	Name    string   `json:"name"`
+	Mode    string   `json:"mode"`
+	Aliases []string `json:"aliases"`
+}
+
+var mapCatalog = []MapCatalogEntry{
+	{Name: "antarctic peninsula", Mode: "control", Aliases: []string{"antarctica", "antarctic"}},
+	{Name: "busan", Mode: "control"},
+	{Name: "ilios", Mode: "control"},
+	{Name: "lijiang tower", Mode: "control", Aliases: []string{"lijiang"}},
+	{Name: "nepal", Mode: "control"},
+	{Name: "oasis", Mode: "control"},
+	{Name: "samoa", Mode: "control"},
+
+	{Name: "circuit royal", Mode: "escort", Aliases: []string{"circuit"}},
+	{Name: "dorado", Mode: "escort"},
+	{Name: "havana", Mode: "escort"},
+	{Name: "junkertown", Mode: "escort", Aliases: []string{"junker town"}},
+	{Name: "rialto", Mode: "escort"},
+	{Name: "route 66", Mode: "escort", Aliases: []string{"route66", "route"}},
+	{Name: "shambali monastery", Mode: "escort", Aliases: []string{"shambali"}},
+	{Name: "watchpoint: gibraltar", Mode: "escort", Aliases: []string{"watchpoint gibraltar", "gibraltar", "watchpoint"}},
+
+	{Name: "blizzard world", Mode: "hybrid", Aliases: []string{"blizz world", "blizzworld"}},
+	{Name: "eichenwalde", Mode: "hybrid", Aliases: []string{"eichen"}},
+	{Name: "hollywood", Mode: "hybrid"},
+	{Name: "king's row", Mode: "hybrid", Aliases: []string{"kings row", "kingsrow", "kings"}},
+	{Name: "midtown", Mode: "hybrid"},
+	{Name: "numbani", Mode: "hybrid"},
+	{Name: "paraíso", Mode: "hybrid", Aliases: []string{"paraiso"}},
+
+	{Name: "colosseo", Mode: "push", Aliases: []string{"colosseum"}},
+	{Name: "esperança", Mode: "push", Aliases: []string{"esperanca"}},
+	{Name: "new queen street", Mode: "push", Aliases: []string{"nqs", "queen street"}},
+	{Name: "runasapi", Mode: "push"},
+
+	{Name: "aatlis", Mode: "flashpoint"},
+	{Name: "new junk city", Mode: "flashpoint", Aliases: []string{"njc", "junk city"}},
+	{Name: "suravasa", Mode: "flashpoint"},
+
+	{Name: "hanaoka", Mode: "clash"},
+	{Name: "throne of anubis", Mode: "clash", Aliases: []string{"anubis"}},
+}
+
+func MapCatalogHandler(c *gin.Context) {
+	respond(c, mapCatalog, nil, nil)
+}
+
+// resolveMapName returns the canonical name for any spelling of a map in the
+// catalog. Case, underscores, apostrophes and colons are ignored.
+func resolveMapName(name string) (string, bool) {
+
+	key := mapNameKey(name)
+
+	for _, entry := range mapCatalog {
+		if mapNameKey(entry.Name) == key {
+			return entry.Name, true
+		}
+		for _, alias := range entry.Aliases {
+			if mapNameKey(alias) == key {
+				return entry.Name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func mapNameKey(name string) string {
+
+	name = strings.ToLower(strings.ReplaceAll(name, "_", " "))
+	name = strings.NewReplacer("'", "", "’", "", ":", "").Replace(name)
+
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// normalizeMapNames rewrites map names saved before the catalog existed to
+// their canonical spelling, so "kings row" and "king's row" are counted together.
+func normalizeMapNames(db *sql.DB) error {
+
+	var names []string
+
+	rows, err := db.Query("SELECT DISTINCT name FROM map")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		canonical, found := resolveMapName(name)
+		if !found || canonical == name {
+			continue
+		}
+
+		_, err := db.Exec("UPDATE map SET name = ? WHERE name = ?", canonical, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkMapTeams cross-checks an upload against the match it's uploaded to. The
+// claimed winner has to be one of the match's teams, and the teams named in the
+// log's team column must not belong to a different match.
+//
+// The winner itself can't be checked against the log. The Workshop script only
+// logs each player's cumulative stats and team every 5 seconds, with nothing
+// about the score or objective progress, and the end of a map looks the same
+// whoever won it. So the winner is whatever the uploader says, within the
+// match, and a wrong one is fixed by amending the map.
+func checkMapTeams(matchTeams [2]string, winner string, playerStats []PlayerStats, db *sql.DB) error {
+
+	if winner != "draw" && winner != matchTeams[0] && winner != matchTeams[1] {
+		return errBadRequest("winner_not_in_match", fmt.Sprintf("%s isn't playing in this match (%s vs %s)", winner, matchTeams[0], matchTeams[1]))
+	}
+
+	var logTeams []string
+
+	for _, player := range playerStats {
+		team := strings.ToLower(player.Team)
+		if findIndexInSlice(logTeams, team) == -1 {
+			logTeams = append(logTeams, team)
+		}
+	}
+
+	if len(logTeams) != 2 {
+		return errBadRequest("invalid_log", fmt.Sprintf("Expected two teams in the log, found %d", len(logTeams)))
+	}
+
+	// In-game team names are often left as "Team 1" and "Team 2", so only
+	// names of teams we know about can contradict the match
+	for _, team := range logTeams {
+		if team == matchTeams[0] || team == matchTeams[1] {
+			continue
+		}
+
+		exists, err := teamExists(team, db)
+		if err != nil {
+			return errInternal(err, "Internal server error")
+		}
+		if exists {
+			return errConflict("log_teams_mismatch", fmt.Sprintf("The log was recorded for %s, who isn't playing in this match (%s vs %s)", team, matchTeams[0], matchTeams[1]))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// logColumns is the number of comma separated columns in a Workshop log row:
+// timestamp, player, hero, the ten tracked stats and the player's team.
+const logColumns = 14
+
+// maxLogErrors stops a log in the wrong format from producing an error per line.
+const maxLogErrors = 25
+
+// logRow is one parsed row of a Workshop log. The Workshop script writes a row
+// with the cumulative stats of every player present each 5 seconds.
+type logRow struct {
+	Line    int
+	Seconds int
+	Player  string
+	Hero    string
+	Stats   [10]float64
+	Team    string
+}
+
+// LogError is a validation error for a single line of a Workshop log. Hero is
+// set when the line was rejected for a hero that isn't in heroes.json.
+type LogError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+	Hero    string `json:"hero,omitempty"`
+}
+
+func (e LogError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// LogErrors is every validation error found in a log.
+type LogErrors []LogError
+
+func (e LogErrors) Error() string {
+
+	var messages []string
+
+	for i := range e {
+		messages = append(messages, e[i].Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// logPlayer is the parser's running state for one player. Players are
+// discovered as they show up in the log, so substitutes and 6v6 rosters need
+// no special handling.
+type logPlayer struct {
+	stats PlayerStats
+	// prevRow is the baseline the next row's stats are diffed against
+	prevRow logRow
+	// lastRow is the most recent row logged for the player
+	lastRow  logRow
+	lastTick int
+	// carried holds cumulative stats from before the player's counters were
+	// reset by leaving and rejoining the match
+	carried  [10]float64
+	timeline []TimelinePoint
+}
+
+// logParser groups log rows into 5 second ticks and folds every tick into the
+// stats of the players that were present for it.
+type logParser struct {
+	players            []*logPlayer
+	playersByName      map[string]*logPlayer
+	tickCount          int
+	prevSeconds        int
+	totalTimeInSeconds int
+	setupPhase         bool
+	setupSeconds       int
+	rounds             []Round
+}
+
+func parseLog(reader io.Reader) ([]PlayerStats, Map, error) {
+
+	var (
+		players       []PlayerStats
+		tick          []logRow
+		playedMap     Map
+		logErrors     LogErrors
+		unknownHeroes = make(map[string]bool)
+	)
+
+	parser := logParser{playersByName: make(map[string]*logPlayer)}
+
+	scanner := bufio.NewScanner(reader)
+
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		row, logErr := parseLogRow(line, lineNumber)
+		if logErr != nil {
+			// A hero missing from the catalog is on every row it was played, report it once
+			if logErr.Hero != "" {
+				if unknownHeroes[heroNameKey(logErr.Hero)] {
+					continue
+				}
+				unknownHeroes[heroNameKey(logErr.Hero)] = true
+			}
+
+			logErrors = append(logErrors, *logErr)
+			if len(logErrors) >= maxLogErrors {
+				break
+			}
+			continue
+		}
+
+		// Keep validating the rest of the log, but the stats are no longer usable
+		if len(logErrors) > 0 {
+			continue
+		}
+
+		if startsNewTick(tick, row) {
+			parser.addTick(tick)
+			tick = tick[:0]
+		}
+
+		tick = append(tick, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return players, playedMap, err
+	}
+
+	if len(logErrors) > 0 {
+		return players, playedMap, logErrors
+	}
+
+	if len(tick) == 0 {
+		return players, playedMap, LogErrors{{Line: lineNumber, Message: "log has no player rows"}}
+	}
+
+	parser.addTick(tick)
+
+	for _, player := range parser.players {
+		players = append(players, player.endOfGameStats())
+		playedMap.Timeline.Players = append(playedMap.Timeline.Players, PlayerTimeline{Player: player.stats.Name, Points: player.timeline})
+	}
+
+	playedMap.TotalTimeInSeconds = parser.totalTimeInSeconds
+	playedMap.Timeline.Rounds = parser.rounds
+
+	return players, playedMap, nil
+}
+
+// startsNewTick reports whether row belongs to the next tick. The Workshop
+// logs every present player once per tick, so a repeated player or a jump in
+// time closes the current tick.
+func startsNewTick(tick []logRow, row logRow) bool {
+
+	if len(tick) == 0 {
+		return false
+	}
+
+	if row.Seconds > tick[0].Seconds+2 || row.Seconds < tick[0].Seconds {
+		return true
+	}
+
+	for i := range tick {
+		if tick[i].Player == row.Player {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (parser *logParser) addTick(rows []logRow) {
+
+	if len(rows) == 0 {
+		return
+	}
+
+	parser.tickCount++
+
+	// A gap of more than two ticks means the Workshop paused logging during
+	// setup. The first live tick after a setup phase starts a new round.
+	currSeconds := rows[0].Seconds
+	if currSeconds <= parser.prevSeconds+10 {
+		parser.totalTimeInSeconds += 5
+		if parser.setupPhase || len(parser.rounds) == 0 {
+			parser.rounds = append(parser.rounds, Round{Number: len(parser.rounds) + 1, StartSeconds: parser.totalTimeInSeconds, SetupSeconds: parser.setupSeconds})
+			parser.setupSeconds = 0
+		}
+		parser.rounds[len(parser.rounds)-1].EndSeconds = parser.totalTimeInSeconds
+		parser.setupPhase = false
+	} else {
+		// The very first tick has no previous timestamp to measure a setup from
+		if parser.tickCount > 1 {
+			parser.setupSeconds += currSeconds - parser.prevSeconds
+		}
+		parser.setupPhase = true
+	}
+	parser.prevSeconds = currSeconds
+
+	for _, row := range rows {
+
+		player, found := parser.playersByName[row.Player]
+		if !found {
+			player = &logPlayer{stats: PlayerStats{Name: row.Player}}
+			parser.playersByName[row.Player] = player
+			parser.players = append(parser.players, player)
+		}
+
+		if found && statsDecreased(player.lastRow.Stats, row.Stats) {
+			player.carried = addStats(player.carried, player.lastRow.Stats)
+			player.prevRow.Stats = [10]float64{}
+		}
+
+		// Only count the 5 seconds since the previous tick if the player was there for all of it
+		present := found && player.lastTick == parser.tickCount-1
+
+		if present && !parser.setupPhase {
+			player.stats = addRowToHeroStats(player.stats, row, player.prevRow)
+			player.stats.DurationInSeconds += 5
+		}
+
+		if !parser.setupPhase {
+			player.timeline = append(player.timeline, timelinePoint(row, player.carried, parser.totalTimeInSeconds, len(parser.rounds)))
+		}
+
+		player.prevRow = row
+		player.lastRow = row
+		player.lastTick = parser.tickCount
+	}
+}
+
+func timelinePoint(row logRow, carried [10]float64, seconds int, round int) TimelinePoint {
+
+	stats := addStats(carried, row.Stats)
+
+	return TimelinePoint{
+		Seconds:            seconds,
+		Round:              round,
+		Hero:               row.Hero,
+		DamageDealt:        stats[0],
+		DamageTaken:        stats[1],
+		Deaths:             stats[2],
+		FinalBlows:         stats[3],
+		Eliminations:       stats[4],
+		SoloKills:          stats[5],
+		HealingDealt:       stats[6],
+		EnvironmentalKills: stats[7],
+		OffensiveAssists:   stats[8],
+		UltsUsed:           stats[9],
+	}
+}
+
+// endOfGameStats returns the player's map totals from the last cumulative
+// stats they logged, plus anything carried over from before a rejoin.
+func (player *logPlayer) endOfGameStats() PlayerStats {
+
+	stats := player.stats
+	totals := addStats(player.carried, player.lastRow.Stats)
+
+	stats.DamageDealt = totals[0]
+	stats.DamageTaken = totals[1]
+	stats.Deaths = totals[2]
+	stats.FinalBlows = totals[3]
+	stats.Eliminations = totals[4]
+	stats.SoloKills = totals[5]
+	stats.HealingDealt = totals[6]
+	stats.EnvironmentalKills = totals[7]
+	stats.OffensiveAssists = totals[8]
+	stats.UltsUsed = totals[9]
+	stats.Team = player.lastRow.Team
+
+	return stats
+}
+
+// parseLogRow validates a single log line. Hero names are resolved to their
+// canonical name so the rest of the parser never sees aliases.
+func parseLogRow(line string, lineNumber int) (logRow, *LogError) {
+
+	var row logRow
+
+	row.Line = lineNumber
+
+	seconds, err := parseTimestamp(line)
+	if err != nil {
+		return row, &LogError{Line: lineNumber, Message: err.Error()}
+	}
+	row.Seconds = seconds
+
+	columns := strings.Split(line, ",")
+	if len(columns) != logColumns {
+		return row, &LogError{Line: lineNumber, Message: fmt.Sprintf("expected %d columns, found %d", logColumns, len(columns))}
+	}
+
+	row.Player = strings.TrimSpace(columns[1])
+	if row.Player == "" {
+		return row, &LogError{Line: lineNumber, Message: "missing player name"}
+	}
+
+	name := strings.TrimSpace(columns[2])
+
+	hero, found := resolveHeroName(name)
+	if !found {
+		return row, &LogError{Line: lineNumber, Message: fmt.Sprintf("unknown hero %q", name), Hero: name}
+	}
+	row.Hero = hero
+
+	for i := 0; i < len(row.Stats); i++ {
+		value, err := strconv.ParseFloat(strings.TrimSpace(columns[i+3]), 64)
+		if err != nil {
+			return row, &LogError{Line: lineNumber, Message: fmt.Sprintf("column %d (%s): %q is not a number", i+4, statNames[i], columns[i+3])}
+		}
+		row.Stats[i] = value
+	}
+
+	row.Team = strings.TrimSpace(columns[13])
+	if row.Team == "" {
+		return row, &LogError{Line: lineNumber, Message: "missing team"}
+	}
+
+	return row, nil
+}
+
+// parseTimestamp reads the [hh:mm:ss] prefix the Workshop puts on every line
+// and returns it in seconds.
+func parseTimestamp(line string) (int, error) {
+
+	end := strings.Index(line, "]")
+	if !strings.HasPrefix(line, "[") || end == -1 {
+		return 0, fmt.Errorf("missing [hh:mm:ss] timestamp")
+	}
+
+	timeString := line[1:end]
+	timeArray := strings.Split(timeString, ":")
+	if len(timeArray) != 3 {
+		return 0, fmt.Errorf("bad timestamp %q", timeString)
+	}
+
+	hours, err := strconv.Atoi(timeArray[0])
+	if err != nil || hours < 0 {
+		return 0, fmt.Errorf("bad timestamp %q", timeString)
+	}
+
+	minutes, err := strconv.Atoi(timeArray[1])
+	if err != nil || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("bad timestamp %q", timeString)
+	}
+
+	// Some Workshop versions log fractional seconds
+	seconds, err := strconv.ParseFloat(timeArray[2], 64)
+	if err != nil || seconds < 0 || seconds >= 60 {
+		return 0, fmt.Errorf("bad timestamp %q", timeString)
+	}
+
+	return hours*3600 + minutes*60 + int(seconds), nil
+}
+
+func addRowToHeroStats(player PlayerStats, row logRow, prevRow logRow) PlayerStats {
+
+	stats := subtractStats(row.Stats, prevRow.Stats)
+
+	for j := 0; j < len(player.Heroes); j++ {
+		if player.Heroes[j].Hero == row.Hero {
+			player.Heroes[j].TimeSpentInSeconds += 5
+			player.Heroes[j] = addHeroStats(player.Heroes[j], stats)
+			return player
+		}
+	}
+
+	player.Heroes = append(player.Heroes, addHeroStats(HeroStats{Hero: row.Hero, TimeSpentInSeconds: 5}, stats))
+
+	return player
+}
+
+func addHeroStats(playerHero HeroStats, stats [10]float64) HeroStats {
+
+	playerHero.DamageDealt += stats[0]
+	playerHero.DamageTaken += stats[1]
+	playerHero.Deaths += stats[2]
+	playerHero.FinalBlows += stats[3]
+	playerHero.Eliminations += stats[4]
+	playerHero.SoloKills += stats[5]
+	playerHero.HealingDealt += stats[6]
+	playerHero.EnvironmentalKills += stats[7]
+	playerHero.OffensiveAssists += stats[8]
+	playerHero.UltsUsed += stats[9]
+
+	return playerHero
+
+}
+
+func subtractStats(newStats [10]float64, oldStats [10]float64) [10]float64 {
+
+	for i := 0; i < 10; i++ {
+		newStats[i] = newStats[i] - oldStats[i]
+	}
+
+	return newStats
+}
+
+func addStats(stats [10]float64, other [10]float64) [10]float64 {
+
+	for i := 0; i < 10; i++ {
+		stats[i] = stats[i] + other[i]
+	}
+
+	return stats
+}
+
+// statsDecreased reports whether any cumulative stat went down, which only
+// happens when the game reset a player's counters.
+func statsDecreased(oldStats [10]float64, newStats [10]float64) bool {
+
+	for i := 0; i < 10; i++ {
+		if newStats[i] < oldStats[i] {
+			return true
+		}
+	}
+
+	return false
+}
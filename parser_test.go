@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testHeroCatalog swaps in a small hero catalog for the length of a test.
+func testHeroCatalog(t *testing.T) {
+
+	catalog := heroCatalog
+	t.Cleanup(func() { heroCatalog = catalog })
+
+	heroCatalog = []HeroCatalogEntry{
+		{Name: "ana", DisplayName: "Ana", Role: "support"},
+		{Name: "genji", DisplayName: "Genji", Role: "damage"},
+		{Name: "reinhardt", DisplayName: "Reinhardt", Role: "tank", Aliases: []string{"rein"}},
+	}
+}
+
+// logLine writes a Workshop log row the way the Workshop script does, seconds
+// after 20:00:00 and with every stat but damage dealt left at 0.
+func logLine(seconds int, player string, hero string, damage float64, team string) string {
+
+	seconds += 20 * 3600
+
+	return fmt.Sprintf("[%02d:%02d:%02d] 1,%s,%s,%.1f,0,0,0,0,0,0,0,0,0,%s", seconds/3600, seconds/60%60, seconds%60, player, hero, damage, team)
+}
+
+func TestParseLog(t *testing.T) {
+
+	testHeroCatalog(t)
+
+	type playerWant struct {
+		team     string
+		duration int
+		damage   float64
+		heroes   []HeroStats
+	}
+
+	tests := []struct {
+		name      string
+		lines     []string
+		totalTime int
+		rounds    []Round
+		players   map[string]playerWant
+	}{
+		{
+			name: "ticks",
+			lines: []string{
+				logLine(0, "p0", "Ana", 0, "Team A"),
+				logLine(0, "p1", "Genji", 0, "Team B"),
+				logLine(5, "p0", "Ana", 100, "Team A"),
+				logLine(5, "p1", "Genji", 50, "Team B"),
+				logLine(10, "p0", "Ana", 250, "Team A"),
+				logLine(10, "p1", "Genji", 75, "Team B"),
+			},
+			totalTime: 10,
+			rounds:    []Round{{Number: 1, StartSeconds: 5, EndSeconds: 10}},
+			players: map[string]playerWant{
+				"p0": {team: "Team A", duration: 10, damage: 250, heroes: []HeroStats{{Hero: "ana", TimeSpentInSeconds: 10, DamageDealt: 250}}},
+				"p1": {team: "Team B", duration: 10, damage: 75, heroes: []HeroStats{{Hero: "genji", TimeSpentInSeconds: 10, DamageDealt: 75}}},
+			},
+		},
+		{
+			name: "setup gap starts a new round",
+			lines: []string{
+				logLine(0, "p0", "Ana", 0, "Team A"),
+				logLine(5, "p0", "Ana", 100, "Team A"),
+				logLine(10, "p0", "Ana", 200, "Team A"),
+				logLine(40, "p0", "Ana", 300, "Team A"),
+				logLine(45, "p0", "Ana", 350, "Team A"),
+				logLine(50, "p0", "Ana", 400, "Team A"),
+			},
+			totalTime: 20,
+			rounds:    []Round{{Number: 1, StartSeconds: 5, EndSeconds: 10}, {Number: 2, StartSeconds: 15, EndSeconds: 20, SetupSeconds: 30}},
+			players: map[string]playerWant{
+				"p0": {team: "Team A", duration: 20, damage: 400, heroes: []HeroStats{{Hero: "ana", TimeSpentInSeconds: 20, DamageDealt: 300}}},
+			},
+		},
+		{
+			name: "hero swap",
+			lines: []string{
+				logLine(0, "p0", "Ana", 0, "Team A"),
+				logLine(5, "p0", "Ana", 100, "Team A"),
+				logLine(10, "p0", "Genji", 150, "Team A"),
+				logLine(15, "p0", "Genji", 250, "Team A"),
+			},
+			totalTime: 15,
+			rounds:    []Round{{Number: 1, StartSeconds: 5, EndSeconds: 15}},
+			players: map[string]playerWant{
+				"p0": {team: "Team A", duration: 15, damage: 250, heroes: []HeroStats{{Hero: "ana", TimeSpentInSeconds: 5, DamageDealt: 100}, {Hero: "genji", TimeSpentInSeconds: 10, DamageDealt: 150}}},
+			},
+		},
+		{
+			name: "aliases resolve to the canonical hero",
+			lines: []string{
+				logLine(0, "p0", "Rein", 0, "Team A"),
+				logLine(5, "p0", "REINHARDT", 100, "Team A"),
+			},
+			totalTime: 5,
+			rounds:    []Round{{Number: 1, StartSeconds: 5, EndSeconds: 5}},
+			players: map[string]playerWant{
+				"p0": {team: "Team A", duration: 5, damage: 100, heroes: []HeroStats{{Hero: "reinhardt", TimeSpentInSeconds: 5, DamageDealt: 100}}},
+			},
+		},
+		{
+			name: "substitution",
+			lines: []string{
+				logLine(0, "p0", "Ana", 0, "Team A"),
+				logLine(5, "p0", "Ana", 100, "Team A"),
+				logLine(10, "p0", "Ana", 200, "Team A"),
+				logLine(15, "p1", "Ana", 0, "Team A"),
+				logLine(20, "p1", "Ana", 80, "Team A"),
+			},
+			totalTime: 20,
+			rounds:    []Round{{Number: 1, StartSeconds: 5, EndSeconds: 20}},
+			players: map[string]playerWant{
+				"p0": {team: "Team A", duration: 10, damage: 200, heroes: []HeroStats{{Hero: "ana", TimeSpentInSeconds: 10, DamageDealt: 200}}},
+				"p1": {team: "Team A", duration: 5, damage: 80, heroes: []HeroStats{{Hero: "ana", TimeSpentInSeconds: 5, DamageDealt: 80}}},
+			},
+		},
+		{
+			name: "rejoin carries stats over the counter reset",
+			lines: []string{
+				logLine(0, "p0", "Ana", 0, "Team A"),
+				logLine(0, "p1", "Genji", 0, "Team B"),
+				logLine(5, "p0", "Ana", 100, "Team A"),
+				logLine(5, "p1", "Genji", 10, "Team B"),
+				logLine(10, "p0", "Ana", 200, "Team A"),
+				logLine(10, "p1", "Genji", 20, "Team B"),
+				logLine(15, "p1", "Genji", 30, "Team B"),
+				logLine(20, "p0", "Ana", 0, "Team A"),
+				logLine(20, "p1", "Genji", 40, "Team B"),
+				logLine(25, "p0", "Ana", 50, "Team A"),
+				logLine(25, "p1", "Genji", 50, "Team B"),
+			},
+			totalTime: 25,
+			rounds:    []Round{{Number: 1, StartSeconds: 5, EndSeconds: 25}},
+			players: map[string]playerWant{
+				"p0": {team: "Team A", duration: 15, damage: 250, heroes: []HeroStats{{Hero: "ana", TimeSpentInSeconds: 15, DamageDealt: 250}}},
+				"p1": {team: "Team B", duration: 25, damage: 50, heroes: []HeroStats{{Hero: "genji", TimeSpentInSeconds: 25, DamageDealt: 50}}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			players, playedMap, err := parseLog(strings.NewReader(strings.Join(test.lines, "\n")))
+			if err != nil {
+				t.Fatalf("parseLog() error: %v", err)
+			}
+
+			if playedMap.TotalTimeInSeconds != test.totalTime {
+				t.Errorf("total time = %d, want %d", playedMap.TotalTimeInSeconds, test.totalTime)
+			}
+			if !reflect.DeepEqual(playedMap.Timeline.Rounds, test.rounds) {
+				t.Errorf("rounds = %+v, want %+v", playedMap.Timeline.Rounds, test.rounds)
+			}
+
+			if len(players) != len(test.players) {
+				t.Fatalf("got %d players, want %d", len(players), len(test.players))
+			}
+
+			for _, player := range players {
+				want, found := test.players[player.Name]
+				if !found {
+					t.Errorf("unexpected player %s", player.Name)
+					continue
+				}
+				if player.Team != want.team {
+					t.Errorf("%s: team = %q, want %q", player.Name, player.Team, want.team)
+				}
+				if player.DurationInSeconds != want.duration {
+					t.Errorf("%s: duration = %d, want %d", player.Name, player.DurationInSeconds, want.duration)
+				}
+				if player.DamageDealt != want.damage {
+					t.Errorf("%s: damage = %v, want %v", player.Name, player.DamageDealt, want.damage)
+				}
+				if !reflect.DeepEqual(player.Heroes, want.heroes) {
+					t.Errorf("%s: heroes = %+v, want %+v", player.Name, player.Heroes, want.heroes)
+				}
+			}
+		})
+	}
+}
+
+func TestParseLogErrors(t *testing.T) {
+
+	testHeroCatalog(t)
+
+	tests := []struct {
+		name   string
+		lines  []string
+		errors LogErrors
+	}{
+		{
+			name:   "no player rows",
+			lines:  []string{"", "  "},
+			errors: LogErrors{{Line: 2, Message: "log has no player rows"}},
+		},
+		{
+			name:   "missing timestamp",
+			lines:  []string{"1,p0,Ana,0,0,0,0,0,0,0,0,0,0,Team A"},
+			errors: LogErrors{{Line: 1, Message: "missing [hh:mm:ss] timestamp"}},
+		},
+		{
+			name:   "bad timestamp",
+			lines:  []string{"[20:61:00] 1,p0,Ana,0,0,0,0,0,0,0,0,0,0,Team A"},
+			errors: LogErrors{{Line: 1, Message: `bad timestamp "20:61:00"`}},
+		},
+		{
+			name:   "wrong column count",
+			lines:  []string{logLine(0, "p0", "Ana", 0, "Team A"), "[20:00:05] 1,p0,Ana,0,0,Team A"},
+			errors: LogErrors{{Line: 2, Message: "expected 14 columns, found 6"}},
+		},
+		{
+			name:   "stat is not a number",
+			lines:  []string{"[20:00:00] 1,p0,Ana,lots,0,0,0,0,0,0,0,0,0,Team A"},
+			errors: LogErrors{{Line: 1, Message: `column 4 (damageDealt): "lots" is not a number`}},
+		},
+		{
+			name:   "every bad line is reported",
+			lines:  []string{logLine(0, "p0", "Nobody", 0, "Team A"), logLine(0, "", "Ana", 0, "Team A"), logLine(0, "p2", "Ana", 0, "")},
+			errors: LogErrors{{Line: 1, Message: `unknown hero "Nobody"`, Hero: "Nobody"}, {Line: 2, Message: "missing player name"}, {Line: 3, Message: "missing team"}},
+		},
+		{
+			name: "unknown hero is reported once",
+			lines: []string{
+				logLine(0, "p0", "Hazard", 0, "Team A"),
+				logLine(0, "p1", "Ana", 0, "Team B"),
+				logLine(5, "p0", "Hazard", 100, "Team A"),
+				logLine(5, "p1", "Ana", 100, "Team B"),
+			},
+			errors: LogErrors{{Line: 1, Message: `unknown hero "Hazard"`, Hero: "Hazard"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			_, _, err := parseLog(strings.NewReader(strings.Join(test.lines, "\n")))
+
+			logErrors, ok := err.(LogErrors)
+			if !ok {
+				t.Fatalf("parseLog() error = %v, want LogErrors", err)
+			}
+			if !reflect.DeepEqual(logErrors, test.errors) {
+				t.Errorf("errors = %+v, want %+v", logErrors, test.errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// discordMention matches a Discord user ID, on its own or as a <@ID> mention.
+var discordMention = regexp.MustCompile(`^<@!?(\d{15,20})>$|^(\d{15,20})$`)
+
+func PlayerProfileHandler(c *gin.Context) {
+	profile, err := GetPlayerProfile(c)
+	respond(c, profile, err, func() string { return formatPlayerProfileMessage(profile) })
+}
+
+func AddPlayerAliasHandler(c *gin.Context) {
+	profile, err := AddPlayerAlias(c)
+	respond(c, profile, err, func() string { return formatPlayerProfileMessage(profile) })
+}
+
+func RemovePlayerAliasHandler(c *gin.Context) {
+	profile, err := RemovePlayerAlias(c)
+	respond(c, profile, err, func() string { return formatPlayerProfileMessage(profile) })
+}
+
+func LinkDiscordHandler(c *gin.Context) {
+	profile, err := LinkDiscord(c)
+	respond(c, profile, err, func() string { return formatPlayerProfileMessage(profile) })
+}
+
+func GetPlayerProfile(c *gin.Context) (PlayerProfile, error) {
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	player, err := lookupPlayer(requestValue(c, "player"), db)
+	if err != nil {
+		return PlayerProfile{}, err
+	}
+
+	profile, err := getPlayerProfile(player, db)
+	if err != nil {
+		return profile, errInternal(err, "Internal server error")
+	}
+
+	return profile, nil
+}
+
+// AddPlayerAlias records another name or BattleTag a player goes by. If the
+// alias already has stats as a player of its own, those stats are merged in,
+// which is how renames and smurfs are joined up after the fact.
+func AddPlayerAlias(c *gin.Context) (PlayerProfile, error) {
+
+	alias := strings.ToLower(strings.TrimSpace(requestValue(c, "alias")))
+	kind := strings.ToLower(requestValue(c, "kind"))
+
+	if alias == "" {
+		return PlayerProfile{}, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	if kind == "" {
+		kind = "name"
+		if strings.Contains(alias, "#") {
+			kind = "battletag"
+		}
+	}
+	if kind != "name" && kind != "battletag" {
+		return PlayerProfile{}, errBadRequest("invalid_alias_kind", "An alias is either a name or a battletag")
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	player, err := lookupPlayer(requestValue(c, "player"), db)
+	if err != nil {
+		return PlayerProfile{}, err
+	}
+
+	if alias == player {
+		return PlayerProfile{}, errBadRequest("alias_is_player", fmt.Sprintf("%s is already called %s", player, alias))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return PlayerProfile{}, errInternal(err, "Internal server error")
+	}
+	defer tx.Rollback()
+
+	owner, err := resolvePlayerName(alias, tx)
+	if err != nil {
+		return PlayerProfile{}, errInternal(err, "Internal server error")
+	}
+	if owner != alias && owner != player {
+		return PlayerProfile{}, errConflict("alias_taken", fmt.Sprintf("%s is already an alias of %s", alias, owner))
+	}
+
+	exists, err := playerExists(alias, tx)
+	if err != nil {
+		return PlayerProfile{}, errInternal(err, "Internal server error")
+	}
+	if exists {
+		err = mergePlayers(alias, player, tx)
+		if err != nil {
+			return PlayerProfile{}, err
+		}
+	}
+
+	_, err = tx.Exec("INSERT INTO playerAlias (alias, player, kind) VALUES (?, ?, ?) ON CONFLICT (alias) DO UPDATE SET player = excluded.player, kind = excluded.kind", alias, player, kind)
+	if err != nil {
+		return PlayerProfile{}, errInternal(err, "Internal server error")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return PlayerProfile{}, errInternal(err, "Internal server error")
+	}
+
+	profile, err := getPlayerProfile(player, db)
+	if err != nil {
+		return profile, errInternal(err, "Internal server error")
+	}
+
+	return profile, nil
+}
+
+func RemovePlayerAlias(c *gin.Context) (PlayerProfile, error) {
+
+	alias := strings.ToLower(strings.TrimSpace(requestValue(c, "alias")))
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	player, err := lookupPlayer(requestValue(c, "player"), db)
+	if err != nil {
+		return PlayerProfile{}, err
+	}
+
+	result, err := db.Exec("DELETE FROM playerAlias WHERE alias = ? AND player = ?", alias, player)
+	if err != nil {
+		return PlayerProfile{}, errInternal(err, "Internal server error")
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		return PlayerProfile{}, errNotFound("alias_not_found", fmt.Sprintf("%s isn't an alias of %s", alias, player))
+	}
+
+	profile, err := getPlayerProfile(player, db)
+	if err != nil {
+		return profile, errInternal(err, "Internal server error")
+	}
+
+	return profile, nil
+}
+
+// LinkDiscord sets the Discord account of a player, so the bot can look
+// players up by mention.
+func LinkDiscord(c *gin.Context) (PlayerProfile, error) {
+
+	discordID := discordUserID(requestValue(c, "discordID"))
+
+	if discordID == "" {
+		return PlayerProfile{}, errBadRequest("invalid_discord_id", "Give a Discord user ID or mention")
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	player, err := lookupPlayer(requestValue(c, "player"), db)
+	if err != nil {
+		return PlayerProfile{}, err
+	}
+
+	var linked string
+
+	err = db.QueryRow("SELECT name FROM player WHERE discordID = ?", discordID).Scan(&linked)
+	if err == nil && linked != player {
+		return PlayerProfile{}, errConflict("discord_id_taken", fmt.Sprintf("This Discord account is already linked to %s", linked))
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return PlayerProfile{}, errInternal(err, "Internal server error")
+	}
+
+	_, err = db.Exec("UPDATE player SET discordID = ? WHERE name = ?", discordID, player)
+	if err != nil {
+		return PlayerProfile{}, errInternal(err, "Internal server error")
+	}
+
+	profile, err := getPlayerProfile(player, db)
+	if err != nil {
+		return profile, errInternal(err, "Internal server error")
+	}
+
+	return profile, nil
+}
+
+// lookupPlayer finds the player a request refers to by name, alias, BattleTag
+// or Discord ID.
+func lookupPlayer(lookup string, db queryer) (string, error) {
+
+	lookup = strings.ToLower(strings.TrimSpace(lookup))
+
+	if lookup == "" {
+		return "", errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	if discordID := discordUserID(lookup); discordID != "" {
+		var player string
+
+		err := db.QueryRow("SELECT name FROM player WHERE discordID = ?", discordID).Scan(&player)
+		if err == nil {
+			return player, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", errInternal(err, "Internal server error")
+		}
+	}
+
+	player, err := resolvePlayerName(lookup, db)
+	if err != nil {
+		return "", errInternal(err, "Internal server error")
+	}
+
+	exists, err := playerExists(player, db)
+	if err != nil {
+		return "", errInternal(err, "Internal server error")
+	}
+	if !exists {
+		return "", errNotFound("player_not_found", fmt.Sprintf("Player %s not found", lookup))
+	}
+
+	return player, nil
+}
+
+// resolvePlayerName returns the player a name or BattleTag belongs to. Names
+// nobody has claimed as an alias are their own player.
+func resolvePlayerName(name string, db queryer) (string, error) {
+
+	var player string
+
+	err := db.QueryRow("SELECT player FROM playerAlias WHERE alias = ?", name).Scan(&player)
+	if errors.Is(err, sql.ErrNoRows) {
+		return name, nil
+	}
+	if err != nil {
+		return name, fmt.Errorf("resolvePlayerName(): %w", err)
+	}
+
+	return player, nil
+}
+
+// resolveLogPlayers renames the players of a parsed log to the players their
+// in-game names are aliases of.
+func resolveLogPlayers(playerStats []PlayerStats, timeline MapTimeline, db queryer) ([]PlayerStats, MapTimeline, error) {
+
+	resolved := make(map[string]string)
+
+	for i := range playerStats {
+		name := strings.ToLower(playerStats[i].Name)
+
+		player, err := resolvePlayerName(name, db)
+		if err != nil {
+			return playerStats, timeline, errInternal(err, "Internal server error")
+		}
+
+		for logName, other := range resolved {
+			if other == player {
+				return playerStats, timeline, errBadRequest("duplicate_player", fmt.Sprintf("%s and %s in the log are both %s", logName, name, player))
+			}
+		}
+
+		resolved[name] = player
+		playerStats[i].Name = player
+	}
+
+	for i := range timeline.Players {
+		if player, found := resolved[strings.ToLower(timeline.Players[i].Player)]; found {
+			timeline.Players[i].Player = player
+		}
+	}
+
+	return playerStats, timeline, nil
+}
+
+// mergePlayers moves every stat of from over to into and removes from. The
+// two can't have played on the same map.
+func mergePlayers(from string, into string, db queryer) error {
+
+	var shared int
+
+	err := db.QueryRow("SELECT COUNT(*) FROM mapPlayer a JOIN mapPlayer b ON a.mapID = b.mapID WHERE a.player = ? AND b.player = ?", from, into).Scan(&shared)
+	if err != nil {
+		return errInternal(err, "Internal server error")
+	}
+	if shared > 0 {
+		return errConflict("players_overlap", fmt.Sprintf("%s and %s played on the same map, so they can't be the same player", from, into))
+	}
+
+	_, err = db.Exec("DELETE FROM rosterMembership WHERE player = ?", from)
+	if err != nil {
+		return errInternal(err, "Internal server error")
+	}
+
+	for _, table := range []string{"mapPlayer", "mapPlayerHero", "mapTimeline", "playerAlias"} {
+		_, err := db.Exec(fmt.Sprintf("UPDATE %s SET player = ? WHERE player = ?", table), into, from)
+		if err != nil {
+			return errInternal(err, "Internal server error")
+		}
+	}
+
+	// from has no stats left, so this only takes it off the leaderboards
+	err = refreshBuiltLeaderboards([]string{from, into}, db)
+	if err != nil {
+		return errInternal(err, "Internal server error")
+	}
+
+	var discordID sql.NullString
+
+	err = db.QueryRow("SELECT discordID FROM player WHERE name = ?", from).Scan(&discordID)
+	if err != nil {
+		return errInternal(err, "Internal server error")
+	}
+
+	_, err = db.Exec("DELETE FROM player WHERE name = ?", from)
+	if err != nil {
+		return errInternal(err, "Internal server error")
+	}
+
+	_, err = db.Exec("UPDATE player SET discordID = COALESCE(discordID, ?) WHERE name = ?", discordID, into)
+	if err != nil {
+		return errInternal(err, "Internal server error")
+	}
+
+	err = rebuildRosters([]string{into}, db)
+	if err != nil {
+		return errInternal(err, "Internal server error")
+	}
+
+	return nil
+}
+
+func playerExists(player string, db queryer) (bool, error) {
+
+	var count int
+
+	err := db.QueryRow("SELECT COUNT(*) FROM player WHERE name = ?", player).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func getPlayerProfile(player string, db queryer) (PlayerProfile, error) {
+
+	var (
+		profile   PlayerProfile
+		team      sql.NullString
+		discordID sql.NullString
+	)
+
+	err := db.QueryRow("SELECT ID, name, team, discordID FROM player WHERE name = ?", player).Scan(&profile.ID, &profile.Name, &team, &discordID)
+	if err != nil {
+		return profile, err
+	}
+	profile.Team, profile.DiscordID = team.String, discordID.String
+
+	rows, err := db.Query("SELECT alias, kind FROM playerAlias WHERE player = ? ORDER BY alias", player)
+	if err != nil {
+		return profile, fmt.Errorf("getPlayerProfile(): %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var alias PlayerAlias
+		if err := rows.Scan(&alias.Alias, &alias.Kind); err != nil {
+			return profile, fmt.Errorf("getPlayerProfile(): %w", err)
+		}
+		profile.Aliases = append(profile.Aliases, alias)
+	}
+
+	return profile, rows.Err()
+}
+
+func discordUserID(value string) string {
+
+	match := discordMention.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return ""
+	}
+
+	return match[1] + match[2]
+}
+
+func formatPlayerProfileMessage(profile PlayerProfile) string {
+
+	message := fmt.Sprintf("%s (#%d)", profile.Name, profile.ID)
+
+	if profile.Team != "" {
+		message += fmt.Sprintf("\nTeam: %s", teamDisplayName(profile.Team))
+	}
+
+	if profile.DiscordID != "" {
+		message += fmt.Sprintf("\nDiscord: <@%s>", profile.DiscordID)
+	}
+
+	if len(profile.Aliases) > 0 {
+		var aliases []string
+		for _, alias := range profile.Aliases {
+			aliases = append(aliases, alias.Alias)
+		}
+		message += "\nAlso known as: " + strings.Join(aliases, ", ")
+	}
+
+	return message
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RosterHandler(c *gin.Context) {
+	roster, err := TeamRoster(c)
+	respond(c, roster, err, func() string { return formatRosterMessage(roster) })
+}
+
+// TeamRoster lists who played for a team in a season, the current season by
+// default, and from when until when.
+func TeamRoster(c *gin.Context) (Roster, error) {
+
+	var roster Roster
+
+	roster.Team = strings.ToLower(strings.ReplaceAll(requestValue(c, "team"), "_", " "))
+
+	if roster.Team == "" {
+		return roster, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	exists, err := teamExists(roster.Team, db)
+	if err != nil {
+		return roster, errInternal(err, "Internal server error")
+	}
+	if !exists {
+		return roster, errNotFound("team_not_found", "Team not found")
+	}
+
+	roster.Season, err = requestedSeason(c, db)
+	if err != nil {
+		return roster, err
+	}
+
+	rows, err := db.Query("SELECT player, seasonID, joinedAt, leftAt, maps FROM rosterMembership WHERE team = ? AND seasonID = ? ORDER BY firstMapID, player", roster.Team, roster.Season)
+	if err != nil {
+		return roster, errInternal(err, "Internal server error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		membership, err := scanRosterMembership(rows)
+		if err != nil {
+			return roster, errInternal(err, "Internal server error")
+		}
+		roster.Players = append(roster.Players, membership)
+	}
+
+	if err = rows.Err(); err != nil {
+		return roster, errInternal(err, "Internal server error")
+	}
+
+	return roster, nil
+}
+
+// assignLogTeams replaces the team names in a log with the teams of the match.
+// Lobbies are often left with the default "Team 1" and "Team 2", so a log team
+// that isn't named after either team of the match is matched up by where its
+// players played before.
+func assignLogTeams(matchTeams [2]string, playerStats []PlayerStats, db queryer) ([]PlayerStats, error) {
+
+	var logTeams []string
+
+	for _, player := range playerStats {
+		team := strings.ToLower(player.Team)
+		if findIndexInSlice(logTeams, team) == -1 {
+			logTeams = append(logTeams, team)
+		}
+	}
+
+	// checkMapTeams has made sure there are two
+	swapped := logTeams[0] == matchTeams[1] || logTeams[1] == matchTeams[0]
+
+	if findIndexInSlice(matchTeams[:], logTeams[0]) == -1 && findIndexInSlice(matchTeams[:], logTeams[1]) == -1 {
+
+		// votes[i][j] is how many players of log team i last played for match team j
+		var votes [2][2]int
+
+		for _, player := range playerStats {
+			var team sql.NullString
+
+			err := db.QueryRow("SELECT team FROM player WHERE name = ?", player.Name).Scan(&team)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return playerStats, errInternal(err, "Internal server error")
+			}
+
+			i := findIndexInSlice(logTeams, strings.ToLower(player.Team))
+			if j := findIndexInSlice(matchTeams[:], team.String); j != -1 {
+				votes[i][j]++
+			}
+		}
+
+		kept, crossed := votes[0][0]+votes[1][1], votes[0][1]+votes[1][0]
+		if kept == crossed {
+			return playerStats, errBadRequest("unknown_log_teams", fmt.Sprintf("Couldn't tell which team in the log is %s, name the teams in the lobby after the teams of the match", matchTeams[0]))
+		}
+		swapped = crossed > kept
+	}
+
+	for i := range playerStats {
+		j := findIndexInSlice(logTeams, strings.ToLower(playerStats[i].Team))
+		if swapped {
+			j = 1 - j
+		}
+		playerStats[i].Team = matchTeams[j]
+	}
+
+	return playerStats, nil
+}
+
+// rebuildRosters recomputes the roster memberships of players from the maps
+// they played. Consecutive maps for the same team in the same season make up
+// one membership, which ends when the player first plays for another team.
+func rebuildRosters(players []string, db queryer) error {
+
+	type stint struct {
+		team                  string
+		season                int
+		joinedAt, leftAt      *time.Time
+		firstMapID, lastMapID int
+		maps                  int
+	}
+
+	for _, player := range players {
+
+		var stints []stint
+
+		_, err := db.Exec("DELETE FROM rosterMembership WHERE player = ?", player)
+		if err != nil {
+			return fmt.Errorf("rebuildRosters(): %w", err)
+		}
+
+		rows, err := db.Query(`SELECT mapPlayer.mapID, mapPlayer.team, game.seasonID, map.playedAt
+		FROM mapPlayer
+		JOIN map ON map.ID = mapPlayer.mapID
+		JOIN game ON game.ID = map.gameID
+		WHERE mapPlayer.player = ? AND mapPlayer.team IS NOT NULL
+		ORDER BY map.ID`, player)
+		if err != nil {
+			return fmt.Errorf("rebuildRosters(): %w", err)
+		}
+
+		for rows.Next() {
+			var (
+				current  stint
+				playedAt sql.NullString
+			)
+
+			if err := rows.Scan(&current.firstMapID, &current.team, &current.season, &playedAt); err != nil {
+				rows.Close()
+				return fmt.Errorf("rebuildRosters(): %w", err)
+			}
+
+			last := len(stints) - 1
+
+			if last >= 0 && stints[last].team == current.team && stints[last].season == current.season {
+				stints[last].lastMapID = current.firstMapID
+				stints[last].maps++
+				continue
+			}
+
+			current.joinedAt, err = parseStoredTime(playedAt)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("rebuildRosters(): %w", err)
+			}
+
+			if last >= 0 {
+				stints[last].leftAt = current.joinedAt
+			}
+
+			current.lastMapID, current.maps = current.firstMapID, 1
+			stints = append(stints, current)
+		}
+
+		rows.Close()
+
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("rebuildRosters(): %w", err)
+		}
+
+		for _, stint := range stints {
+			_, err := db.Exec("INSERT INTO rosterMembership (player, team, seasonID, joinedAt, leftAt, firstMapID, lastMapID, maps) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", player, stint.team, stint.season, nullableTime(stint.joinedAt), nullableTime(stint.leftAt), stint.firstMapID, stint.lastMapID, stint.maps)
+			if err != nil {
+				return fmt.Errorf("rebuildRosters(): %w", err)
+			}
+		}
+
+		// A player's team is whoever they last played for
+		if len(stints) > 0 {
+			_, err = db.Exec("UPDATE player SET team = ? WHERE name = ?", stints[len(stints)-1].team, player)
+			if err != nil {
+				return fmt.Errorf("rebuildRosters(): %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getPlayerStints returns a player's roster memberships with their stats over
+// each one. Memberships without maps under the filter are left out.
+func getPlayerStints(player string, filter StatsFilter, db *sql.DB) ([]RosterMembership, error) {
+
+	var (
+		stints   []RosterMembership
+		mapRange [][2]int
+	)
+
+	rows, err := db.Query("SELECT team, seasonID, joinedAt, leftAt, maps, firstMapID, lastMapID FROM rosterMembership WHERE player = ? AND (? = 0 OR seasonID = ?) ORDER BY firstMapID", player, filter.Season, filter.Season)
+	if err != nil {
+		return stints, fmt.Errorf("getPlayerStints(): %w", err)
+	}
+
+	for rows.Next() {
+		var (
+			stint            RosterMembership
+			joinedAt, leftAt sql.NullString
+			maps             [2]int
+		)
+
+		if err := rows.Scan(&stint.Team, &stint.Season, &joinedAt, &leftAt, &stint.Maps, &maps[0], &maps[1]); err != nil {
+			rows.Close()
+			return stints, fmt.Errorf("getPlayerStints(): %w", err)
+		}
+
+		stint, err = rosterTimes(stint, joinedAt, leftAt)
+		if err != nil {
+			rows.Close()
+			return stints, fmt.Errorf("getPlayerStints(): %w", err)
+		}
+
+		stints = append(stints, stint)
+		mapRange = append(mapRange, maps)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return stints, fmt.Errorf("getPlayerStints(): %w", err)
+	}
+
+	var filtered []RosterMembership
+
+	condition, args := filter.sql("mapPlayer")
+
+	for i, stint := range stints {
+		var stats PlayerStats
+
+		err := db.QueryRow("SELECT COUNT(*), COALESCE(SUM(damageDealt), 0), COALESCE(SUM(damageTaken), 0), COALESCE(SUM(deaths), 0), COALESCE(SUM(finalBlows), 0), COALESCE(SUM(eliminations), 0), COALESCE(SUM(soloKills), 0), COALESCE(SUM(healingDealt), 0), COALESCE(SUM(environmentalKills), 0), COALESCE(SUM(offensiveAssists), 0), COALESCE(SUM(ultsUsed), 0), COALESCE(SUM(durationInSeconds), 0) FROM mapPlayer WHERE player = ? AND team = ? AND mapID BETWEEN ? AND ?"+condition, append([]any{player, stint.Team, mapRange[i][0], mapRange[i][1]}, args...)...).Scan(&stint.Maps, &stats.DamageDealt, &stats.DamageTaken, &stats.Deaths, &stats.FinalBlows, &stats.Eliminations, &stats.SoloKills, &stats.HealingDealt, &stats.EnvironmentalKills, &stats.OffensiveAssists, &stats.UltsUsed, &stats.DurationInSeconds)
+		if err != nil {
+			return stints, fmt.Errorf("getPlayerStints(): %w", err)
+		}
+
+		if stint.Maps == 0 {
+			continue
+		}
+
+		stats = calcStatsP10(stats)
+		stint.DurationInSeconds, stint.Per10 = stats.DurationInSeconds, &stats.Per10
+
+		filtered = append(filtered, stint)
+	}
+
+	return filtered, nil
+}
+
+// getMapPlayers returns who played on a map, so their rosters can be rebuilt
+// once the map changes.
+func getMapPlayers(mapID int, db queryer) ([]string, error) {
+
+	var players []string
+
+	rows, err := db.Query("SELECT player FROM mapPlayer WHERE mapID = ?", mapID)
+	if err != nil {
+		return players, fmt.Errorf("getMapPlayers(): %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var player string
+		if err := rows.Scan(&player); err != nil {
+			return players, fmt.Errorf("getMapPlayers(): %w", err)
+		}
+		players = append(players, player)
+	}
+
+	return players, rows.Err()
+}
+
+func scanRosterMembership(rows *sql.Rows) (RosterMembership, error) {
+
+	var (
+		membership       RosterMembership
+		joinedAt, leftAt sql.NullString
+	)
+
+	err := rows.Scan(&membership.Player, &membership.Season, &joinedAt, &leftAt, &membership.Maps)
+	if err != nil {
+		return membership, err
+	}
+
+	return rosterTimes(membership, joinedAt, leftAt)
+}
+
+func rosterTimes(membership RosterMembership, joinedAt sql.NullString, leftAt sql.NullString) (RosterMembership, error) {
+
+	var err error
+
+	membership.JoinedAt, err = parseStoredTime(joinedAt)
+	if err != nil {
+		return membership, err
+	}
+
+	membership.LeftAt, err = parseStoredTime(leftAt)
+	if err != nil {
+		return membership, err
+	}
+
+	return membership, nil
+}
+
+func nullableTime(t *time.Time) any {
+
+	if t == nil {
+		return nil
+	}
+
+	return formatTime(*t)
+}
+
+func formatRosterMessage(roster Roster) string {
+
+	if len(roster.Players) == 0 {
+		return fmt.Sprintf("No one has played for %s this season", teamDisplayName(roster.Team))
+	}
+
+	message := fmt.Sprintf("%s roster:\n", teamDisplayName(roster.Team))
+
+	for _, membership := range roster.Players {
+		message += fmt.Sprintf("%s (%d maps)", membership.Player, membership.Maps)
+		if membership.LeftAt != nil {
+			message += fmt.Sprintf(", left <t:%d:d>", membership.LeftAt.Unix())
+		}
+		message += "\n"
+	}
+
+	return message
+}
+
+func formatStintsMessage(stints []RosterMembership) string {
+
+	message := "Teams:\n"
+
+	for _, stint := range stints {
+		message += fmt.Sprintf("%s, season %d: %d maps\n", teamDisplayName(stint.Team), stint.Season, stint.Maps)
+	}
+
+	return message
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// matchLength is how long a calendar entry blocks per map of the series.
+const matchLength = 30 * time.Minute
+
+func ScheduleMatchHandler(c *gin.Context) {
+	series, err := ScheduleMatch(c)
+	respond(c, series, err, func() string { return formatScheduleMessage([]Series{series}) })
+}
+
+func UpcomingMatchesHandler(c *gin.Context) {
+	matches, err := UpcomingMatches(c)
+	respond(c, matches, err, func() string { return formatScheduleMessage(matches) })
+}
+
+func TodaysMatchesHandler(c *gin.Context) {
+	matches, err := TodaysMatches(c)
+	respond(c, matches, err, func() string { return formatScheduleMessage(matches) })
+}
+
+func RecentResultsHandler(c *gin.Context) {
+	matches, err := RecentResults(c)
+	respond(c, matches, err, func() string { return formatScheduleMessage(matches) })
+}
+
+func TeamCalendarHandler(c *gin.Context) {
+
+	calendar, err := TeamCalendar(c)
+	if err != nil {
+		respond(c, nil, err, nil)
+		return
+	}
+
+	c.Header("Content-Disposition", "inline; filename=\"schedule.ics\"")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(calendar))
+}
+
+// ScheduleMatch sets or moves a match's start time.
+func ScheduleMatch(c *gin.Context) (Series, error) {
+
+	var series Series
+
+	matchID, _ := strconv.Atoi(requestValue(c, "matchID"))
+	scheduled := requestValue(c, "scheduledAt")
+
+	if matchID == 0 || scheduled == "" {
+		return series, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	scheduledAt, err := parseScheduledAt(scheduled)
+	if err != nil {
+		return series, err
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	result, err := db.Exec("UPDATE game SET scheduledAt = ? WHERE ID = ?", scheduledAt, matchID)
+	if err != nil {
+		return series, errInternal(err, "Internal server error")
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return series, errNotFound("match_not_found", "Match not found")
+	}
+
+	series, err = getSeries(matchID, db)
+	if err != nil {
+		return series, errInternal(err, "Internal server error")
+	}
+
+	return series, nil
+}
+
+// UpcomingMatches returns matches scheduled from now on, soonest first.
+func UpcomingMatches(c *gin.Context) ([]Series, error) {
+
+	limit, err := limitParam(c)
+	if err != nil {
+		return nil, err
+	}
+
+	team := strings.ToLower(strings.ReplaceAll(c.Query("team"), "_", " "))
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	return listSeries("SELECT ID FROM game WHERE scheduledAt >= ? AND (? = '' OR ? IN (team1, team2)) ORDER BY scheduledAt LIMIT ?", db, formatTime(time.Now()), team, team, limit)
+}
+
+// TodaysMatches returns the matches scheduled for today, in the timezone given
+// by tz or UTC.
+func TodaysMatches(c *gin.Context) ([]Series, error) {
+
+	location := time.UTC
+
+	if tz := c.Query("tz"); tz != "" {
+		var err error
+		location, err = time.LoadLocation(tz)
+		if err != nil {
+			return nil, errBadRequest("invalid_timezone", fmt.Sprintf("Unknown timezone %s", tz))
+		}
+	}
+
+	now := time.Now().In(location)
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	return listSeries("SELECT ID FROM game WHERE scheduledAt >= ? AND scheduledAt < ? ORDER BY scheduledAt", db, formatTime(start), formatTime(start.AddDate(0, 0, 1)))
+}
+
+// RecentResults returns the matches with maps most recently uploaded to them.
+func RecentResults(c *gin.Context) ([]Series, error) {
+
+	limit, err := limitParam(c)
+	if err != nil {
+		return nil, err
+	}
+
+	team := strings.ToLower(strings.ReplaceAll(c.Query("team"), "_", " "))
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	return listSeries("SELECT game.ID FROM game JOIN map ON map.gameID = game.ID WHERE ? = '' OR ? IN (game.team1, game.team2) GROUP BY game.ID ORDER BY MAX(map.ID) DESC LIMIT ?", db, team, team, limit)
+}
+
+// TeamCalendar renders a team's scheduled matches as an iCalendar feed.
+func TeamCalendar(c *gin.Context) (string, error) {
+
+	team := strings.ToLower(strings.ReplaceAll(requestValue(c, "team"), "_", " "))
+
+	if team == "" {
+		return "", errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	exists, err := teamExists(team, db)
+	if err != nil {
+		return "", errInternal(err, "Internal server error")
+	}
+	if !exists {
+		return "", errNotFound("team_not_found", "Team not found")
+	}
+
+	matches, err := listSeries("SELECT ID FROM game WHERE scheduledAt IS NOT NULL AND ? IN (team1, team2) ORDER BY scheduledAt", db, team)
+	if err != nil {
+		return "", err
+	}
+
+	return formatCalendar(team, matches, time.Now()), nil
+}
+
+func listSeries(query string, db *sql.DB, args ...any) ([]Series, error) {
+
+	var (
+		matchIDs []int
+		matches  []Series
+	)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return matches, errInternal(err, "Internal server error")
+	}
+
+	for rows.Next() {
+		var matchID int
+		if err := rows.Scan(&matchID); err != nil {
+			rows.Close()
+			return matches, errInternal(err, "Internal server error")
+		}
+		matchIDs = append(matchIDs, matchID)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return matches, errInternal(err, "Internal server error")
+	}
+
+	for _, matchID := range matchIDs {
+		series, err := getSeries(matchID, db)
+		if err != nil {
+			return matches, errInternal(err, "Internal server error")
+		}
+		matches = append(matches, series)
+	}
+
+	return matches, nil
+}
+
+func limitParam(c *gin.Context) (int, error) {
+
+	limit := c.Query("limit")
+	if limit == "" {
+		return 10, nil
+	}
+
+	value, err := strconv.Atoi(limit)
+	if err != nil || value <= 0 {
+		return 0, errBadRequest("invalid_limit", fmt.Sprintf("Invalid limit %s", limit))
+	}
+
+	return value, nil
+}
+
+// parseScheduledAt reads an RFC 3339 time such as 2024-05-04T19:00:00+02:00.
+// Times are stored in UTC so they sort as text.
+func parseScheduledAt(value string) (string, error) {
+
+	scheduledAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "", errBadRequest("invalid_time", fmt.Sprintf("%s isn't a time like 2024-05-04T19:00:00+02:00", value))
+	}
+
+	return formatTime(scheduledAt), nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseStoredTime reads a time saved by formatTime. NULL is nil.
+func parseStoredTime(value sql.NullString) (*time.Time, error) {
+
+	if !value.Valid {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value.String)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func formatScheduleMessage(matches []Series) string {
+
+	if len(matches) == 0 {
+		return "No matches found"
+	}
+
+	var lines []string
+
+	for _, series := range matches {
+		line := formatSeriesMessage(series)
+		if series.ScheduledAt != nil && !series.Decided {
+			line = fmt.Sprintf("<t:%d:f> %s vs %s", series.ScheduledAt.Unix(), teamDisplayName(series.Team1), teamDisplayName(series.Team2))
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// formatCalendar writes an iCalendar (RFC 5545) feed with an event per match.
+func formatCalendar(team string, matches []Series, now time.Time) string {
+
+	const icsTime = "20060102T150405Z"
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Saltwater Showdown//SaltwaterBot//EN",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:" + icsEscape("Saltwater Showdown - "+teamDisplayName(team)),
+	}
+
+	for _, series := range matches {
+
+		maps := series.BestOf
+		if maps == 0 {
+			maps = 3
+		}
+
+		summary := fmt.Sprintf("%s vs %s", teamDisplayName(series.Team1), teamDisplayName(series.Team2))
+		if series.GrandFinals {
+			summary = "Grand Finals: " + summary
+		}
+
+		description := formatSeriesMessage(series)
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:match-%d@saltwaterbot", series.MatchID),
+			"DTSTAMP:"+now.UTC().Format(icsTime),
+			"DTSTART:"+series.ScheduledAt.UTC().Format(icsTime),
+			"DTEND:"+series.ScheduledAt.Add(time.Duration(maps)*matchLength).UTC().Format(icsTime),
+			"SUMMARY:"+icsEscape(summary),
+			"DESCRIPTION:"+icsEscape(description),
+			"END:VEVENT",
+		)
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+
+	var calendar strings.Builder
+
+	for _, line := range lines {
+		// Lines longer than 75 octets are folded onto continuation lines, which
+		// start with a space that counts towards their 75
+		limit := 75
+		for len(line) > limit {
+			cut := limit
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			calendar.WriteString(line[:cut] + "\r\n ")
+			line = line[cut:]
+			limit = 74
+		}
+		calendar.WriteString(line + "\r\n")
+	}
+
+	return calendar.String()
+}
+
+func icsEscape(text string) string {
+	return strings.NewReplacer("\\", "\\\\", ";", "\\;", ",", "\\,", "\n", "\\n").Replace(text)
+}
+
+// getMatchTimes fills in when a match is scheduled and when its last map was
+// played.
+func getMatchTimes(series Series, db queryer) (Series, error) {
+
+	var scheduledAt, playedAt sql.NullString
+
+	err := db.QueryRow("SELECT game.scheduledAt, (SELECT MAX(playedAt) FROM map WHERE map.gameID = game.ID) FROM game WHERE ID = ?", series.MatchID).Scan(&scheduledAt, &playedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return series, err
+	}
+	if err != nil {
+		return series, fmt.Errorf("getMatchTimes(): %w", err)
+	}
+
+	series.ScheduledAt, err = parseStoredTime(scheduledAt)
+	if err != nil {
+		return series, fmt.Errorf("getMatchTimes(): %w", err)
+	}
+
+	series.PlayedAt, err = parseStoredTime(playedAt)
+	if err != nil {
+		return series, fmt.Errorf("getMatchTimes(): %w", err)
+	}
+
+	return series, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestFormatCalendarFoldsLongLines(t *testing.T) {
+
+	scheduledAt := time.Date(2026, 3, 14, 19, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		team1 string
+		team2 string
+	}{
+		{"short names", "team a", "team b"},
+		{"long ascii names", strings.Repeat("saltwater ", 12), strings.Repeat("showdown ", 12)},
+		{"long multibyte names", strings.Repeat("über ", 30), strings.Repeat("ñandú 🦈 ", 20)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			series := Series{MatchID: 1, Team1: strings.TrimSpace(test.team1), Team2: strings.TrimSpace(test.team2), BestOf: 3, ScheduledAt: &scheduledAt}
+
+			calendar := formatCalendar(series.Team1, []Series{series}, now)
+
+			if !strings.HasSuffix(calendar, "\r\n") {
+				t.Fatalf("calendar doesn't end with CRLF")
+			}
+
+			lines := strings.Split(strings.TrimSuffix(calendar, "\r\n"), "\r\n")
+
+			for i, line := range lines {
+				if len(line) > 75 {
+					t.Errorf("line %d is %d octets long: %q", i+1, len(line), line)
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line %d splits a character: %q", i+1, line)
+				}
+			}
+
+			unfolded := strings.ReplaceAll(calendar, "\r\n ", "")
+
+			want := "DESCRIPTION:" + icsEscape(formatSeriesMessage(series)) + "\r\n"
+			if !strings.Contains(unfolded, want) {
+				t.Errorf("unfolded calendar doesn't contain %q", want)
+			}
+		})
+	}
+}
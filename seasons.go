@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SeasonsHandler(c *gin.Context) {
+	seasons, err := ListSeasons()
+	respond(c, seasons, err, nil)
+}
+
+func CreateSeasonHandler(c *gin.Context) {
+	season, err := CreateSeason(c)
+	respond(c, season, err, func() string { return fmt.Sprintf("%s started (season %d)", season.Name, season.ID) })
+}
+
+func ListSeasons() ([]Season, error) {
+
+	var seasons []Season
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	rows, err := db.Query("SELECT ID, name FROM season ORDER BY ID")
+	if err != nil {
+		return seasons, errInternal(err, "Internal server error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var season Season
+		if err := rows.Scan(&season.ID, &season.Name); err != nil {
+			return seasons, errInternal(err, "Internal server error")
+		}
+		seasons = append(seasons, season)
+	}
+
+	if err = rows.Err(); err != nil {
+		return seasons, errInternal(err, "Internal server error")
+	}
+
+	for i := range seasons {
+		seasons[i].Current = i == len(seasons)-1
+	}
+
+	return seasons, nil
+}
+
+// CreateSeason starts a new season. Matches created from now on are assigned
+// to it unless they name a season themselves.
+func CreateSeason(c *gin.Context) (Season, error) {
+
+	var season Season
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	err := db.QueryRow("SELECT COUNT(*) + 1 FROM season").Scan(&season.ID)
+	if err != nil {
+		return season, errInternal(err, "Internal server error")
+	}
+
+	season.Name = strings.ReplaceAll(requestValue(c, "name"), "_", " ")
+	if season.Name == "" {
+		season.Name = fmt.Sprintf("Season %d", season.ID)
+	}
+
+	season.ID, err = createSeason(season.Name, db)
+	if err != nil {
+		return season, errInternal(err, "Internal server error")
+	}
+
+	season.Current = true
+
+	return season, nil
+}
+
+func createSeason(name string, db queryer) (int, error) {
+
+	var seasonID int
+
+	_, err := db.Exec("INSERT INTO season (name) VALUES (?)", name)
+	if err != nil {
+		return seasonID, fmt.Errorf("createSeason(): %w", err)
+	}
+
+	err = db.QueryRow("SELECT MAX(ID) FROM season").Scan(&seasonID)
+	if err != nil {
+		return seasonID, fmt.Errorf("createSeason(): %w", err)
+	}
+
+	return seasonID, nil
+}
+
+// currentSeason returns the most recently started season, starting the first
+// one if there is none yet.
+func currentSeason(db queryer) (int, error) {
+
+	var seasonID int
+
+	err := db.QueryRow("SELECT ID FROM season ORDER BY ID DESC LIMIT 1").Scan(&seasonID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return createSeason("Season 1", db)
+	}
+	if err != nil {
+		return seasonID, fmt.Errorf("currentSeason(): %w", err)
+	}
+
+	return seasonID, nil
+}
+
+// matchSeason returns the season a new match belongs to: the one requested,
+// or the current season.
+func matchSeason(requested string, db queryer) (int, error) {
+
+	if requested == "" {
+		seasonID, err := currentSeason(db)
+		if err != nil {
+			return seasonID, errInternal(err, "Internal server error")
+		}
+		return seasonID, nil
+	}
+
+	seasonID, err := strconv.Atoi(requested)
+	if err != nil {
+		return seasonID, errBadRequest("invalid_season", fmt.Sprintf("Invalid season %s", requested))
+	}
+
+	var count int
+
+	err = db.QueryRow("SELECT COUNT(*) FROM season WHERE ID = ?", seasonID).Scan(&count)
+	if err != nil {
+		return seasonID, errInternal(err, "Internal server error")
+	}
+	if count == 0 {
+		return seasonID, errNotFound("season_not_found", fmt.Sprintf("Season %d not found", seasonID))
+	}
+
+	return seasonID, nil
+}
+
+// updateSeasonsPlayed recounts the seasons a team has played a match in.
+func updateSeasonsPlayed(team string, db queryer) error {
+
+	_, err := db.Exec("UPDATE team SET seasonsPlayed = (SELECT COUNT(DISTINCT seasonID) FROM game WHERE team1 = team.name OR team2 = team.name) WHERE name = ?", team)
+	if err != nil {
+		return fmt.Errorf("updateSeasonsPlayed(): %w", err)
+	}
+
+	return nil
+}
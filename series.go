@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultBestOf is the length of a match created without a best-of.
+const defaultBestOf = 3
+
+func MatchHandler(c *gin.Context) {
+	series, err := GetSeries(c)
+	respond(c, series, err, func() string { return formatSeriesMessage(series) })
+}
+
+func GetSeries(c *gin.Context) (Series, error) {
+
+	matchID, _ := strconv.Atoi(requestValue(c, "matchID"))
+
+	if matchID == 0 {
+		return Series{}, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	series, err := getSeries(matchID, db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return series, errNotFound("match_not_found", "Match not found")
+	}
+	if err != nil {
+		return series, errInternal(err, "Internal server error")
+	}
+
+	return series, nil
+}
+
+func getSeries(matchID int, db queryer) (Series, error) {
+
+	var (
+		grandfinals int
+		bestOf      sql.NullInt64
+	)
+
+	series := Series{MatchID: matchID}
+
+	err := db.QueryRow("SELECT team1, team2, grandfinals, bestOf, seasonID FROM game WHERE ID = ?", matchID).Scan(&series.Team1, &series.Team2, &grandfinals, &bestOf, &series.Season)
+	if err != nil {
+		return series, err
+	}
+	series.GrandFinals, series.BestOf = grandfinals != 0, int(bestOf.Int64)
+
+	rows, err := db.Query("SELECT COALESCE(winner, 'draw') FROM map WHERE gameID = ?", matchID)
+	if err != nil {
+		return series, fmt.Errorf("getSeries(): %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var winner string
+
+		if err := rows.Scan(&winner); err != nil {
+			return series, fmt.Errorf("getSeries(): %w", err)
+		}
+
+		series.MapsPlayed++
+		switch winner {
+		case series.Team1:
+			series.Team1Score++
+		case series.Team2:
+			series.Team2Score++
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return series, fmt.Errorf("getSeries(): %w", err)
+	}
+
+	series, err = getMatchTimes(series, db)
+	if err != nil {
+		return series, err
+	}
+
+	return decideSeries(series), nil
+}
+
+// decideSeries works out whether a series is over. A team wins once it has won
+// more than half of the best-of, and a series with every map played is over
+// either way, as a draw if the score is level. Only matches created before
+// best-of was recorded have none, and they are taken as finished once they
+// have maps.
+func decideSeries(series Series) Series {
+
+	switch {
+	case series.BestOf == 0:
+		series.Decided = series.MapsPlayed > 0
+	case series.Team1Score > series.BestOf/2 || series.Team2Score > series.BestOf/2:
+		series.Decided = true
+	default:
+		series.Decided = series.MapsPlayed >= series.BestOf
+	}
+
+	if !series.Decided {
+		return series
+	}
+
+	if series.Team1Score > series.Team2Score {
+		series.Winner = series.Team1
+	}
+	if series.Team2Score > series.Team1Score {
+		series.Winner = series.Team2
+	}
+
+	return series
+}
+
+// getTeamSeries returns every match a team has played in a season, 0 being all
+// seasons, and its match record over the ones that are decided.
+func getTeamSeries(teamStats TeamStats, db *sql.DB) (TeamStats, error) {
+
+	var matchIDs []int
+
+	rows, err := db.Query("SELECT ID FROM game WHERE (team1 = ? OR team2 = ?) AND (? = 0 OR seasonID = ?) ORDER BY ID", teamStats.Team, teamStats.Team, teamStats.Season, teamStats.Season)
+	if err != nil {
+		return teamStats, fmt.Errorf("getTeamSeries(): %w", err)
+	}
+
+	for rows.Next() {
+		var matchID int
+		if err := rows.Scan(&matchID); err != nil {
+			rows.Close()
+			return teamStats, fmt.Errorf("getTeamSeries(): %w", err)
+		}
+		matchIDs = append(matchIDs, matchID)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return teamStats, fmt.Errorf("getTeamSeries(): %w", err)
+	}
+
+	for _, matchID := range matchIDs {
+		series, err := getSeries(matchID, db)
+		if err != nil {
+			return teamStats, err
+		}
+
+		teamStats.Series = append(teamStats.Series, series)
+
+		switch {
+		case !series.Decided:
+		case series.Winner == teamStats.Team:
+			teamStats.MatchWins++
+		case series.Winner == "":
+			teamStats.MatchDraws++
+		default:
+			teamStats.MatchLosses++
+		}
+	}
+
+	return teamStats, nil
+}
+
+func formatSeriesMessage(series Series) string {
+
+	message := fmt.Sprintf("%s %d - %d %s", teamDisplayName(series.Team1), series.Team1Score, series.Team2Score, teamDisplayName(series.Team2))
+
+	if series.BestOf != 0 {
+		message += fmt.Sprintf(" (Bo%d)", series.BestOf)
+	}
+
+	switch {
+	case !series.Decided:
+		message += ", in progress"
+	case series.Winner == "":
+		message += ", draw"
+	default:
+		message += fmt.Sprintf(", %s win", teamDisplayName(series.Winner))
+	}
+
+	return message
+}
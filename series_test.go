@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestDecideSeries(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		bestOf      int
+		team1Score  int
+		team2Score  int
+		mapsPlayed  int
+		wantDecided bool
+		wantWinner  string
+	}{
+		{"no maps yet", 3, 0, 0, 0, false, ""},
+		{"one map of a best of three", 3, 1, 0, 1, false, ""},
+		{"two nil in a best of three", 3, 2, 0, 2, true, "a"},
+		{"won on the last map", 3, 1, 2, 3, true, "b"},
+		{"level after every map is a draw", 3, 1, 1, 3, true, ""},
+		{"drawn maps still need a majority", 3, 1, 0, 2, false, ""},
+		{"best of one", 1, 0, 1, 1, true, "b"},
+		{"drawn best of one", 1, 0, 0, 1, true, ""},
+		{"level best of two is a draw", 2, 1, 1, 2, true, ""},
+		{"best of five needs three", 5, 2, 1, 3, false, ""},
+		{"best of five won three one", 5, 3, 1, 4, true, "a"},
+		{"legacy match without maps", 0, 0, 0, 0, false, ""},
+		{"legacy match with maps", 0, 1, 0, 1, true, "a"},
+		{"legacy match with a level score", 0, 1, 1, 2, true, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			series := decideSeries(Series{Team1: "a", Team2: "b", BestOf: test.bestOf, Team1Score: test.team1Score, Team2Score: test.team2Score, MapsPlayed: test.mapsPlayed})
+
+			if series.Decided != test.wantDecided || series.Winner != test.wantWinner {
+				t.Errorf("decided = %v, winner = %q, want %v, %q", series.Decided, series.Winner, test.wantDecided, test.wantWinner)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tiebreakers are applied in order to teams with the same number of match
+// wins until the tie is broken:
+//
+//	headToHead        match wins in matches between the tied teams only
+//	mapDifferential   map wins minus map losses
+//	mapWins           map wins
+//	roundDifferential rounds of maps won minus rounds of maps lost
+//
+// Logs say who won a map but not who won its rounds, so a map's rounds count
+// for the team that won it and against the team that lost it.
+var tiebreakers = []string{"headToHead", "mapDifferential", "mapWins", "roundDifferential"}
+
+// standingsMatch is one group stage match and the maps each team won in it.
+// Only a decided series counts as a match win, loss or draw, its maps count
+// as soon as they're played.
+type standingsMatch struct {
+	teams   [2]string
+	mapWins [2]int
+	maps    int
+	decided bool
+	// roundDifferential is each team's rounds of maps won minus rounds of maps lost
+	roundDifferential [2]int
+}
+
+func newStandingsMatch(series Series) standingsMatch {
+
+	series = decideSeries(series)
+
+	return standingsMatch{
+		teams:   [2]string{series.Team1, series.Team2},
+		mapWins: [2]int{series.Team1Score, series.Team2Score},
+		maps:    series.MapsPlayed,
+		decided: series.Decided,
+	}
+}
+
+func StandingsHandler(c *gin.Context) {
+	standings, err := DivisionStandings(c)
+	respond(c, standings, err, func() string { return formatStandingsMessage(standings) })
+}
+
+// DivisionStandings computes a division's group table from the results of the
+// matches its teams played against each other in the division's season.
+// Grand finals and bracket matches aren't part of the group stage and are left
+// out, and a match only counts as won, lost or drawn once its series is
+// decided.
+func DivisionStandings(c *gin.Context) (Standings, error) {
+
+	var standings Standings
+
+	divisionID, _ := strconv.Atoi(requestValue(c, "divisionID"))
+
+	if divisionID == 0 {
+		return standings, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	standings.Tiebreakers = tiebreakers
+
+	if requested := c.Query("tiebreakers"); requested != "" {
+		standings.Tiebreakers = nil
+		for _, tiebreaker := range strings.Split(requested, ",") {
+			tiebreaker = strings.TrimSpace(tiebreaker)
+			if findIndexInSlice(tiebreakers, tiebreaker) == -1 {
+				return standings, errBadRequest("unknown_tiebreaker", fmt.Sprintf("Unknown tiebreaker %s, expected one of %s", tiebreaker, strings.Join(tiebreakers, ", ")))
+			}
+			standings.Tiebreakers = append(standings.Tiebreakers, tiebreaker)
+		}
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	division, err := getDivision(divisionID, db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return standings, errNotFound("division_not_found", "Division not found")
+	}
+	if err != nil {
+		return standings, errInternal(err, "Internal server error")
+	}
+	standings.Division = division
+
+	standings.Standings, err = getStandings(division, standings.Tiebreakers, db)
+	if err != nil {
+		return standings, errInternal(err, "Internal server error")
+	}
+
+	return standings, nil
+}
+
+func getStandings(division Division, order []string, db queryer) ([]Standing, error) {
+
+	var standings []Standing
+
+	matches, err := getGroupStageResults(division, db)
+	if err != nil {
+		return standings, err
+	}
+
+	table := rankStandings(tallyStandings(division.Teams, matches), matches, order)
+
+	for i, standing := range table {
+		standing.Rank = i + 1
+		standings = append(standings, *standing)
+	}
+
+	return standings, nil
+}
+
+// tallyStandings adds up the match and map record of every team from the
+// group stage matches.
+func tallyStandings(divisionTeams []string, matches []standingsMatch) []*Standing {
+
+	var table []*Standing
+
+	teams := make(map[string]*Standing)
+
+	for _, team := range divisionTeams {
+		teams[team] = &Standing{Team: team}
+		table = append(table, teams[team])
+	}
+
+	for _, match := range matches {
+		for i, team := range match.teams {
+			standing := teams[team]
+			other := match.mapWins[1-i]
+
+			standing.MapWins += match.mapWins[i]
+			standing.MapLosses += other
+			standing.MapDraws += match.maps - match.mapWins[i] - other
+			standing.RoundDifferential += match.roundDifferential[i]
+
+			if !match.decided {
+				continue
+			}
+
+			standing.MatchesPlayed++
+			switch {
+			case match.mapWins[i] > other:
+				standing.MatchWins++
+			case match.mapWins[i] < other:
+				standing.MatchLosses++
+			default:
+				standing.MatchDraws++
+			}
+		}
+	}
+
+	for _, standing := range table {
+		standing.MapDifferential = standing.MapWins - standing.MapLosses
+	}
+
+	return table
+}
+
+// rankStandings sorts teams by match wins and breaks ties with each tiebreaker
+// in turn. Head-to-head is recomputed for every set of tied teams, so a three
+// way tie only looks at the matches between those three.
+func rankStandings(table []*Standing, matches []standingsMatch, order []string) []*Standing {
+
+	groups := splitTies(table, func(standing *Standing) int { return standing.MatchWins })
+
+	var ranked []*Standing
+
+	for _, group := range groups {
+		ranked = append(ranked, breakTies(group, matches, order)...)
+	}
+
+	return ranked
+}
+
+func breakTies(tied []*Standing, matches []standingsMatch, order []string) []*Standing {
+
+	if len(tied) < 2 {
+		return tied
+	}
+
+	if len(order) == 0 {
+		sort.SliceStable(tied, func(i, j int) bool { return tied[i].Team < tied[j].Team })
+		return tied
+	}
+
+	var key func(standing *Standing) int
+
+	switch order[0] {
+	case "headToHead":
+		wins := headToHeadWins(tied, matches)
+		key = func(standing *Standing) int { return wins[standing.Team] }
+	case "mapDifferential":
+		key = func(standing *Standing) int { return standing.MapDifferential }
+	case "mapWins":
+		key = func(standing *Standing) int { return standing.MapWins }
+	case "roundDifferential":
+		key = func(standing *Standing) int { return standing.RoundDifferential }
+	}
+
+	var ranked []*Standing
+
+	for _, group := range splitTies(tied, key) {
+		ranked = append(ranked, breakTies(group, matches, order[1:])...)
+	}
+
+	return ranked
+}
+
+// splitTies sorts teams by key, highest first, and groups teams with the same key.
+func splitTies(table []*Standing, key func(standing *Standing) int) [][]*Standing {
+
+	var groups [][]*Standing
+
+	sorted := append([]*Standing(nil), table...)
+	sort.SliceStable(sorted, func(i, j int) bool { return key(sorted[i]) > key(sorted[j]) })
+
+	for i, standing := range sorted {
+		if i == 0 || key(standing) != key(sorted[i-1]) {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], standing)
+	}
+
+	return groups
+}
+
+func headToHeadWins(tied []*Standing, matches []standingsMatch) map[string]int {
+
+	var teams []string
+
+	for _, standing := range tied {
+		teams = append(teams, standing.Team)
+	}
+
+	wins := make(map[string]int)
+
+	for _, match := range matches {
+		if !match.decided || findIndexInSlice(teams, match.teams[0]) == -1 || findIndexInSlice(teams, match.teams[1]) == -1 {
+			continue
+		}
+		if match.mapWins[0] > match.mapWins[1] {
+			wins[match.teams[0]]++
+		}
+		if match.mapWins[1] > match.mapWins[0] {
+			wins[match.teams[1]]++
+		}
+	}
+
+	return wins
+}
+
+func getDivision(divisionID int, db queryer) (Division, error) {
+
+	division := Division{ID: divisionID}
+
+	err := db.QueryRow("SELECT name, COALESCE(colorHexcode, ''), seasonID FROM division WHERE ID = ?", divisionID).Scan(&division.Name, &division.ColorHexcode, &division.Season)
+	if err != nil {
+		return division, err
+	}
+
+	division.Teams, err = getDivisionTeams(divisionID, db)
+	if err != nil {
+		return division, err
+	}
+
+	return division, nil
+}
+
+// getGroupStageResults returns every match between two teams of the division
+// that has at least one map uploaded.
+func getGroupStageResults(division Division, db queryer) ([]standingsMatch, error) {
+
+	var (
+		matches []standingsMatch
+		series  []Series
+		rounds  [][2]int
+	)
+
+	matchIndex := make(map[int]int)
+
+	query := `SELECT game.ID, game.team1, game.team2, COALESCE(game.bestOf, 0), COALESCE(map.winner, 'draw'), (SELECT COUNT(*) FROM mapRound WHERE mapRound.mapID = map.ID)
+	FROM game
+	JOIN map ON map.gameID = game.ID
+	JOIN teamGroup group1 ON group1.team = game.team1 AND group1.divisionID = ?
+	JOIN teamGroup group2 ON group2.team = game.team2 AND group2.divisionID = ?
+	WHERE game.seasonID = ? AND game.grandfinals = 0
+	AND game.ID NOT IN (SELECT gameID FROM bracketSlot WHERE gameID IS NOT NULL)
+	ORDER BY game.ID, map.ID`
+
+	rows, err := db.Query(query, division.ID, division.ID, division.Season)
+	if err != nil {
+		return matches, fmt.Errorf("getGroupStageResults(): %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			match     Series
+			winner    string
+			mapRounds int
+		)
+
+		if err := rows.Scan(&match.MatchID, &match.Team1, &match.Team2, &match.BestOf, &winner, &mapRounds); err != nil {
+			return matches, fmt.Errorf("getGroupStageResults(): %w", err)
+		}
+
+		i, found := matchIndex[match.MatchID]
+		if !found {
+			i = len(series)
+			matchIndex[match.MatchID] = i
+			series = append(series, match)
+			rounds = append(rounds, [2]int{})
+		}
+
+		series[i].MapsPlayed++
+		if winner == match.Team1 {
+			series[i].Team1Score++
+			rounds[i][0] += mapRounds
+			rounds[i][1] -= mapRounds
+		}
+		if winner == match.Team2 {
+			series[i].Team2Score++
+			rounds[i][0] -= mapRounds
+			rounds[i][1] += mapRounds
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return matches, fmt.Errorf("getGroupStageResults(): %w", err)
+	}
+
+	for i := range series {
+		match := newStandingsMatch(series[i])
+		match.roundDifferential = rounds[i]
+		matches = append(matches, match)
+	}
+
+	return matches, nil
+}
+
+func formatStandingsMessage(standings Standings) string {
+
+	message := fmt.Sprintf("%s standings:\n", standings.Division.Name)
+
+	for _, standing := range standings.Standings {
+		message += fmt.Sprintf("%d. %s: %d-%d-%d (maps %d-%d-%d, %+d)\n", standing.Rank, teamDisplayName(standing.Team), standing.MatchWins, standing.MatchLosses, standing.MatchDraws, standing.MapWins, standing.MapLosses, standing.MapDraws, standing.MapDifferential)
+	}
+
+	return message
+}
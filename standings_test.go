@@ -0,0 +1,183 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// played is a finished group stage match with no drawn maps.
+func played(team1 string, wins1 int, team2 string, wins2 int) standingsMatch {
+	return bestOf(wins1+wins2, team1, wins1, team2, wins2, wins1+wins2)
+}
+
+// bestOf is a group stage match with maps played so far. Maps neither team
+// won are draws.
+func bestOf(length int, team1 string, wins1 int, team2 string, wins2 int, maps int) standingsMatch {
+	return newStandingsMatch(Series{Team1: team1, Team2: team2, BestOf: length, Team1Score: wins1, Team2Score: wins2, MapsPlayed: maps})
+}
+
+// withRounds sets the round differential of a match, positive for the first team.
+func withRounds(match standingsMatch, differential int) standingsMatch {
+	match.roundDifferential = [2]int{differential, -differential}
+	return match
+}
+
+func TestRankStandings(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		teams   []string
+		matches []standingsMatch
+		order   []string
+		want    []string
+	}{
+		{
+			name:    "match wins come first",
+			teams:   []string{"a", "b", "c"},
+			matches: []standingsMatch{played("a", 2, "b", 0), played("c", 1, "a", 2), played("b", 2, "c", 0)},
+			order:   tiebreakers,
+			want:    []string{"a", "b", "c"},
+		},
+		{
+			name:  "head to head beats map differential",
+			teams: []string{"a", "b", "c", "d"},
+			matches: []standingsMatch{
+				played("a", 2, "b", 1), played("c", 2, "a", 0), played("a", 2, "d", 1),
+				played("b", 2, "c", 0), played("b", 2, "d", 0), played("c", 0, "d", 2),
+			},
+			order: tiebreakers,
+			want:  []string{"a", "b", "d", "c"},
+		},
+		{
+			name:    "map differential breaks a three way head to head circle",
+			teams:   []string{"a", "b", "c"},
+			matches: []standingsMatch{played("a", 2, "b", 0), played("b", 2, "c", 1), played("c", 2, "a", 1)},
+			order:   tiebreakers,
+			want:    []string{"a", "c", "b"},
+		},
+		{
+			name:    "head to head is recomputed for the teams still tied",
+			teams:   []string{"a", "b", "c"},
+			matches: []standingsMatch{played("a", 2, "b", 1), played("b", 3, "c", 2), played("c", 2, "a", 1)},
+			order:   tiebreakers,
+			want:    []string{"b", "c", "a"},
+		},
+		{
+			name:  "tiebreakers are applied in the given order",
+			teams: []string{"a", "b", "c", "d"},
+			matches: []standingsMatch{
+				played("a", 2, "b", 1), played("c", 2, "a", 0), played("a", 2, "d", 1),
+				played("b", 2, "c", 0), played("b", 2, "d", 0), played("c", 0, "d", 2),
+			},
+			order: []string{"mapWins"},
+			want:  []string{"b", "a", "d", "c"},
+		},
+		{
+			name:    "round differential is the last tiebreaker",
+			teams:   []string{"a", "b", "c"},
+			matches: []standingsMatch{withRounds(played("a", 2, "b", 1), 3), withRounds(played("b", 2, "c", 1), 1), withRounds(played("c", 2, "a", 1), 1)},
+			order:   tiebreakers,
+			want:    []string{"a", "c", "b"},
+		},
+		{
+			name:  "drawn matches count for neither team",
+			teams: []string{"a", "b", "c"},
+			matches: []standingsMatch{
+				bestOf(2, "a", 1, "b", 1, 2),
+				played("c", 2, "a", 0),
+			},
+			order: tiebreakers,
+			want:  []string{"c", "b", "a"},
+		},
+		{
+			name:  "a partly played series isn't a match win yet",
+			teams: []string{"a", "b", "c"},
+			matches: []standingsMatch{
+				played("a", 2, "c", 0),
+				bestOf(3, "b", 1, "a", 0, 1),
+			},
+			order: tiebreakers,
+			want:  []string{"a", "b", "c"},
+		},
+		{
+			name:  "teams tied on everything are sorted by name",
+			teams: []string{"c", "a", "b"},
+			order: tiebreakers,
+			want:  []string{"a", "b", "c"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			var got []string
+
+			for _, standing := range rankStandings(tallyStandings(test.teams, test.matches), test.matches, test.order) {
+				got = append(got, standing.Team)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ranked %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTallyStandings(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		matches []standingsMatch
+		want    []Standing
+	}{
+		{
+			name:    "decided series",
+			matches: []standingsMatch{played("a", 2, "b", 1), bestOf(3, "b", 1, "a", 1, 3)},
+			want: []Standing{
+				{Team: "a", MatchesPlayed: 2, MatchWins: 1, MatchDraws: 1, MapWins: 3, MapLosses: 2, MapDraws: 1, MapDifferential: 1},
+				{Team: "b", MatchesPlayed: 2, MatchLosses: 1, MatchDraws: 1, MapWins: 2, MapLosses: 3, MapDraws: 1, MapDifferential: -1},
+			},
+		},
+		{
+			name:    "round differential",
+			matches: []standingsMatch{withRounds(played("a", 2, "b", 1), 3), withRounds(bestOf(3, "b", 1, "a", 0, 1), 2)},
+			want: []Standing{
+				{Team: "a", MatchesPlayed: 1, MatchWins: 1, MapWins: 2, MapLosses: 2, MapDifferential: 0, RoundDifferential: 1},
+				{Team: "b", MatchesPlayed: 1, MatchLosses: 1, MapWins: 2, MapLosses: 2, MapDifferential: 0, RoundDifferential: -1},
+			},
+		},
+		{
+			name:    "best of three after one map",
+			matches: []standingsMatch{bestOf(3, "a", 1, "b", 0, 1)},
+			want: []Standing{
+				{Team: "a", MapWins: 1, MapDifferential: 1},
+				{Team: "b", MapLosses: 1, MapDifferential: -1},
+			},
+		},
+		{
+			name:    "best of three level after two maps",
+			matches: []standingsMatch{bestOf(3, "a", 1, "b", 1, 2)},
+			want: []Standing{
+				{Team: "a", MapWins: 1, MapLosses: 1},
+				{Team: "b", MapWins: 1, MapLosses: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			table := tallyStandings([]string{"a", "b"}, test.matches)
+
+			if len(table) != len(test.want) {
+				t.Fatalf("got %d teams, want %d", len(table), len(test.want))
+			}
+
+			for i, standing := range table {
+				if *standing != test.want[i] {
+					t.Errorf("%s: %+v, want %+v", standing.Team, *standing, test.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// teamDisplayNames caches the display names of teams for the message
+// formatters, which don't have the database at hand. It's loaded on start up
+// and whenever a team changes.
+var teamDisplayNames = struct {
+	sync.RWMutex
+	names map[string]string
+}{names: make(map[string]string)}
+
+func TeamsHandler(c *gin.Context) {
+	teams, err := ListTeams(c)
+	respond(c, teams, err, func() string { return formatTeamsMessage(teams) })
+}
+
+func UpdateTeamHandler(c *gin.Context) {
+	team, err := UpdateTeam(c)
+	respond(c, team, err, func() string { return formatTeamsMessage([]Team{team}) })
+}
+
+func MergeTeamHandler(c *gin.Context) {
+	team, err := MergeTeam(c)
+	respond(c, team, err, func() string { return formatTeamsMessage([]Team{team}) })
+}
+
+func ListTeams(c *gin.Context) ([]Team, error) {
+
+	var teams []Team
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	rows, err := db.Query("SELECT name FROM team ORDER BY name")
+	if err != nil {
+		return teams, errInternal(err, "Internal server error")
+	}
+
+	var names []string
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return teams, errInternal(err, "Internal server error")
+		}
+		names = append(names, name)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return teams, errInternal(err, "Internal server error")
+	}
+
+	for _, name := range names {
+		team, err := getTeam(name, db)
+		if err != nil {
+			return teams, errInternal(err, "Internal server error")
+		}
+		teams = append(teams, team)
+	}
+
+	return teams, nil
+}
+
+// UpdateTeam renames a team and sets its display name, tag and logo. Names
+// are stored lowercase, so a new name with capitals in it becomes the display
+// name as well.
+func UpdateTeam(c *gin.Context) (Team, error) {
+
+	team := teamParam(requestValue(c, "team"))
+	rename := strings.TrimSpace(strings.ReplaceAll(requestValue(c, "name"), "_", " "))
+	displayName := strings.TrimSpace(strings.ReplaceAll(requestValue(c, "displayName"), "_", " "))
+	tag := strings.TrimSpace(requestValue(c, "tag"))
+	logoURL := strings.TrimSpace(requestValue(c, "logoURL"))
+
+	if team == "" || rename == "" && displayName == "" && tag == "" && logoURL == "" {
+		return Team{}, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	if len(tag) > 5 || strings.ContainsFunc(tag, unicode.IsSpace) {
+		return Team{}, errBadRequest("invalid_tag", "A tag is up to 5 characters without spaces")
+	}
+
+	if logoURL != "" {
+		logo, err := url.Parse(logoURL)
+		if err != nil || (logo.Scheme != "http" && logo.Scheme != "https") || logo.Host == "" {
+			return Team{}, errBadRequest("invalid_logo_url", fmt.Sprintf("%s isn't an http(s) URL", logoURL))
+		}
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	exists, err := teamExists(team, db)
+	if err != nil {
+		return Team{}, errInternal(err, "Internal server error")
+	}
+	if !exists {
+		return Team{}, errNotFound("team_not_found", "Team not found")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Team{}, errInternal(err, "Internal server error")
+	}
+	defer tx.Rollback()
+
+	if rename != "" && strings.ToLower(rename) != team {
+
+		exists, err := teamExists(strings.ToLower(rename), tx)
+		if err != nil {
+			return Team{}, errInternal(err, "Internal server error")
+		}
+		if exists {
+			return Team{}, errConflict("team_exists", fmt.Sprintf("%s already exists, merge the teams instead", strings.ToLower(rename)))
+		}
+
+		// The name is the primary key everything else refers to, so the team
+		// is copied over to the new name and the old one merged into it
+		_, err = tx.Exec("INSERT INTO team (name, seasonsPlayed, tag, logoURL) SELECT ?, seasonsPlayed, tag, logoURL FROM team WHERE name = ?", strings.ToLower(rename), team)
+		if err != nil {
+			return Team{}, errInternal(err, "Internal server error")
+		}
+
+		err = mergeTeams(team, strings.ToLower(rename), tx)
+		if err != nil {
+			return Team{}, err
+		}
+
+		team = strings.ToLower(rename)
+	}
+
+	if rename != "" && rename != strings.ToLower(rename) && displayName == "" {
+		displayName = rename
+	}
+
+	if displayName != "" {
+		if strings.ToLower(displayName) != team {
+			return Team{}, errBadRequest("invalid_display_name", fmt.Sprintf("%s isn't %s with different capitalization, rename the team instead", displayName, team))
+		}
+
+		_, err = tx.Exec("UPDATE team SET displayName = ? WHERE name = ?", displayName, team)
+		if err != nil {
+			return Team{}, errInternal(err, "Internal server error")
+		}
+	}
+
+	if tag != "" {
+		_, err = tx.Exec("UPDATE team SET tag = ? WHERE name = ?", tag, team)
+		if err != nil {
+			return Team{}, errInternal(err, "Internal server error")
+		}
+	}
+
+	if logoURL != "" {
+		_, err = tx.Exec("UPDATE team SET logoURL = ? WHERE name = ?", logoURL, team)
+		if err != nil {
+			return Team{}, errInternal(err, "Internal server error")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Team{}, errInternal(err, "Internal server error")
+	}
+
+	return reloadTeam(team, db)
+}
+
+// MergeTeam folds a team into another one, typically a misspelt copy that was
+// created by a match, and deletes it.
+func MergeTeam(c *gin.Context) (Team, error) {
+
+	team := teamParam(requestValue(c, "team"))
+	into := teamParam(requestValue(c, "into"))
+
+	if team == "" || into == "" {
+		return Team{}, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	if team == into {
+		return Team{}, errBadRequest("same_team", "A team can't be merged into itself")
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	for _, name := range []string{team, into} {
+		exists, err := teamExists(name, db)
+		if err != nil {
+			return Team{}, errInternal(err, "Internal server error")
+		}
+		if !exists {
+			return Team{}, errNotFound("team_not_found", fmt.Sprintf("Team %s not found", name))
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Team{}, errInternal(err, "Internal server error")
+	}
+	defer tx.Rollback()
+
+	err = mergeTeams(team, into, tx)
+	if err != nil {
+		return Team{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Team{}, errInternal(err, "Internal server error")
+	}
+
+	return reloadTeam(into, db)
+}
+
+// mergeTeams moves everything of from over to into and deletes from. Two
+// teams that played each other can't be the same team.
+func mergeTeams(from string, into string, db queryer) error {
+
+	var played int
+
+	err := db.QueryRow("SELECT COUNT(*) FROM game WHERE (team1 = ? AND team2 = ?) OR (team1 = ? AND team2 = ?)", from, into, into, from).Scan(&played)
+	if err != nil {
+		return errInternal(err, "Internal server error")
+	}
+	if played > 0 {
+		return errConflict("teams_played_each_other", fmt.Sprintf("%s and %s played each other, so they can't be the same team", from, into))
+	}
+
+	updates := []string{
+		"UPDATE player SET team = ? WHERE team = ?",
+		"UPDATE rosterMembership SET team = ? WHERE team = ?",
+		"UPDATE mapPlayer SET team = ? WHERE team = ?",
+		"UPDATE game SET team1 = ? WHERE team1 = ?",
+		"UPDATE game SET team2 = ? WHERE team2 = ?",
+		"UPDATE map SET winner = ? WHERE winner = ?",
+		"UPDATE bracketSlot SET team1 = ? WHERE team1 = ?",
+		"UPDATE bracketSlot SET team2 = ? WHERE team2 = ?",
+		"UPDATE bracketSlot SET winner = ? WHERE winner = ?",
+		// A team is only in a group or pot once, so where both were the
+		// merged team keeps the place of into
+		"UPDATE OR IGNORE teamGroup SET team = ? WHERE team = ?",
+		"UPDATE OR IGNORE pot SET team = ? WHERE team = ?",
+	}
+
+	for _, update := range updates {
+		_, err := db.Exec(update, into, from)
+		if err != nil {
+			return errInternal(err, "Internal server error")
+		}
+	}
+
+	for _, table := range []string{"teamGroup", "pot"} {
+		_, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE team = ?", table), from)
+		if err != nil {
+			return errInternal(err, "Internal server error")
+		}
+	}
+
+	// The display name is a spelling of the old name, the rest carries over
+	_, err = db.Exec("UPDATE team SET tag = COALESCE(tag, (SELECT tag FROM team WHERE name = ?)), logoURL = COALESCE(logoURL, (SELECT logoURL FROM team WHERE name = ?)) WHERE name = ?", from, from, into)
+	if err != nil {
+		return errInternal(err, "Internal server error")
+	}
+
+	_, err = db.Exec("DELETE FROM team WHERE name = ?", from)
+	if err != nil {
+		return errInternal(err, "Internal server error")
+	}
+
+	err = updateSeasonsPlayed(into, db)
+	if err != nil {
+		return errInternal(err, "Internal server error")
+	}
+
+	// Stints with either team may now run into each other
+	var players []string
+
+	rows, err := db.Query("SELECT DISTINCT player FROM rosterMembership WHERE team = ?", into)
+	if err != nil {
+		return errInternal(err, "Internal server error")
+	}
+
+	for rows.Next() {
+		var player string
+		if err := rows.Scan(&player); err != nil {
+			rows.Close()
+			return errInternal(err, "Internal server error")
+		}
+		players = append(players, player)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return errInternal(err, "Internal server error")
+	}
+
+	err = rebuildRosters(players, db)
+	if err != nil {
+		return errInternal(err, "Internal server error")
+	}
+
+	return nil
+}
+
+func getTeam(name string, db queryer) (Team, error) {
+
+	var (
+		team                      Team
+		displayName, tag, logoURL sql.NullString
+	)
+
+	err := db.QueryRow("SELECT name, seasonsPlayed, displayName, tag, logoURL FROM team WHERE name = ?", name).Scan(&team.Name, &team.SeasonsPlayed, &displayName, &tag, &logoURL)
+	if err != nil {
+		return team, err
+	}
+
+	team.DisplayName, team.Tag, team.LogoURL = displayName.String, tag.String, logoURL.String
+	if team.DisplayName == "" {
+		team.DisplayName = capitalizeFirstLetterOfEachWord(team.Name)
+	}
+
+	return team, nil
+}
+
+// reloadTeam refreshes the cached display names after a team changed and
+// returns the team.
+func reloadTeam(name string, db *sql.DB) (Team, error) {
+
+	err := loadTeamDisplayNames(db)
+	if err != nil {
+		return Team{}, errInternal(err, "Internal server error")
+	}
+
+	team, err := getTeam(name, db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return team, errNotFound("team_not_found", "Team not found")
+	}
+	if err != nil {
+		return team, errInternal(err, "Internal server error")
+	}
+
+	return team, nil
+}
+
+func loadTeamDisplayNames(db queryer) error {
+
+	names := make(map[string]string)
+
+	rows, err := db.Query("SELECT name, displayName FROM team WHERE displayName IS NOT NULL")
+	if err != nil {
+		return fmt.Errorf("loadTeamDisplayNames(): %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, displayName string
+		if err := rows.Scan(&name, &displayName); err != nil {
+			return fmt.Errorf("loadTeamDisplayNames(): %w", err)
+		}
+		names[name] = displayName
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("loadTeamDisplayNames(): %w", err)
+	}
+
+	teamDisplayNames.Lock()
+	teamDisplayNames.names = names
+	teamDisplayNames.Unlock()
+
+	return nil
+}
+
+// teamDisplayName is how a team is written in messages: its display name if
+// it has one, otherwise its name with each word capitalized.
+func teamDisplayName(team string) string {
+
+	teamDisplayNames.RLock()
+	displayName, found := teamDisplayNames.names[team]
+	teamDisplayNames.RUnlock()
+
+	if found {
+		return displayName
+	}
+
+	return capitalizeFirstLetterOfEachWord(team)
+}
+
+func teamParam(team string) string {
+	return strings.ToLower(strings.TrimSpace(strings.ReplaceAll(team, "_", " ")))
+}
+
+func formatTeamsMessage(teams []Team) string {
+
+	if len(teams) == 0 {
+		return "No teams found"
+	}
+
+	var lines []string
+
+	for _, team := range teams {
+		line := team.DisplayName
+		if team.Tag != "" {
+			line = fmt.Sprintf("[%s] %s", team.Tag, line)
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
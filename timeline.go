@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func MapTimelineHandler(c *gin.Context) {
+	timeline, err := GetMapTimeline(c)
+	respond(c, timeline, err, nil)
+}
+
+func GetMapTimeline(c *gin.Context) (MapTimeline, error) {
+
+	var timeline MapTimeline
+
+	mapID, _ := strconv.Atoi(requestValue(c, "mapID"))
+	player := strings.ToLower(requestValue(c, "player"))
+
+	if mapID == 0 {
+		return timeline, errBadRequest("missing_parameters", "Missing required query parameters")
+	}
+
+	db := ConnectToDatabase()
+	defer db.Close()
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM map WHERE ID = ?", mapID).Scan(&count)
+	if err != nil {
+		return timeline, errInternal(err, "Internal server error")
+	}
+	if count == 0 {
+		return timeline, errNotFound("map_not_found", "Map not found")
+	}
+
+	if player != "" {
+		player, err = lookupPlayer(player, db)
+		if err != nil {
+			return timeline, err
+		}
+	}
+
+	timeline, err = getMapTimeline(mapID, player, db)
+	if err != nil {
+		return timeline, errInternal(err, "Internal server error")
+	}
+
+	if player != "" && len(timeline.Players) == 0 {
+		return timeline, errNotFound("player_not_found", "Player didn't play on this map")
+	}
+
+	return timeline, nil
+}
+
+// saveTimelineToDB stores the rounds and per tick player stats of a map. The
+// timeline has a row per player every 5 seconds, so callers should pass a
+// transaction.
+func saveTimelineToDB(timeline MapTimeline, mapID int, db queryer) error {
+
+	for _, round := range timeline.Rounds {
+		_, err := db.Exec("INSERT INTO mapRound (mapID, round, startSeconds, endSeconds, setupSeconds) VALUES (?, ?, ?, ?, ?)",
+			mapID, round.Number, round.StartSeconds, round.EndSeconds, round.SetupSeconds)
+		if err != nil {
+			return fmt.Errorf("saveTimelineToDB() - Inserting round: %w", err)
+		}
+	}
+
+	statement, err := db.Prepare(`INSERT INTO mapTimeline (mapID, player, seconds, round, hero, damageDealt, damageTaken, deaths, finalBlows, eliminations, soloKills, healingDealt, environmentalKills, offensiveAssists, ultsUsed) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("saveTimelineToDB() - Preparing timeline insert: %w", err)
+	}
+	defer statement.Close()
+
+	for _, playerTimeline := range timeline.Players {
+		playerName := strings.ToLower(playerTimeline.Player)
+
+		for _, point := range playerTimeline.Points {
+			_, err := statement.Exec(mapID, playerName, point.Seconds, point.Round, point.Hero, point.DamageDealt, point.DamageTaken, point.Deaths, point.FinalBlows, point.Eliminations, point.SoloKills, point.HealingDealt, point.EnvironmentalKills, point.OffensiveAssists, point.UltsUsed)
+			if err != nil {
+				return fmt.Errorf("saveTimelineToDB() - Inserting timeline point: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func getMapTimeline(mapID int, player string, db *sql.DB) (MapTimeline, error) {
+
+	timeline := MapTimeline{MapID: mapID, Rounds: []Round{}, Players: []PlayerTimeline{}}
+
+	rows, err := db.Query("SELECT round, startSeconds, endSeconds, setupSeconds FROM mapRound WHERE mapID = ? ORDER BY round", mapID)
+	if err != nil {
+		return timeline, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var round Round
+		err := rows.Scan(&round.Number, &round.StartSeconds, &round.EndSeconds, &round.SetupSeconds)
+		if err != nil {
+			return timeline, err
+		}
+		timeline.Rounds = append(timeline.Rounds, round)
+	}
+
+	if err = rows.Err(); err != nil {
+		return timeline, err
+	}
+
+	query := "SELECT player, seconds, round, hero, damageDealt, damageTaken, deaths, finalBlows, eliminations, soloKills, healingDealt, environmentalKills, offensiveAssists, ultsUsed FROM mapTimeline WHERE mapID = ? AND (? = '' OR player = ?) ORDER BY player, seconds"
+
+	pointRows, err := db.Query(query, mapID, player, player)
+	if err != nil {
+		return timeline, err
+	}
+	defer pointRows.Close()
+
+	for pointRows.Next() {
+		var (
+			playerName string
+			point      TimelinePoint
+		)
+
+		err := pointRows.Scan(&playerName, &point.Seconds, &point.Round, &point.Hero, &point.DamageDealt, &point.DamageTaken, &point.Deaths, &point.FinalBlows, &point.Eliminations, &point.SoloKills, &point.HealingDealt, &point.EnvironmentalKills, &point.OffensiveAssists, &point.UltsUsed)
+		if err != nil {
+			return timeline, err
+		}
+
+		last := len(timeline.Players) - 1
+		if last == -1 || timeline.Players[last].Player != playerName {
+			timeline.Players = append(timeline.Players, PlayerTimeline{Player: playerName, HeroSwaps: []HeroSwap{}})
+			last++
+		}
+
+		playerTimeline := &timeline.Players[last]
+
+		if len(playerTimeline.Points) > 0 {
+			previous := playerTimeline.Points[len(playerTimeline.Points)-1]
+			if previous.Hero != point.Hero {
+				playerTimeline.HeroSwaps = append(playerTimeline.HeroSwaps, HeroSwap{Seconds: point.Seconds, Round: point.Round, From: previous.Hero, To: point.Hero})
+			}
+		}
+
+		playerTimeline.Points = append(playerTimeline.Points, point)
+	}
+
+	if err = pointRows.Err(); err != nil {
+		return timeline, err
+	}
+
+	return timeline, nil
+}
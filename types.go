@@ -1,18 +1,20 @@
 package main
 
+import "time"
+
 type HeroStats struct {
-	Hero               string
-	TimeSpentInSeconds int
-	DamageDealt        float64
-	DamageTaken        float64
-	Deaths             float64
-	FinalBlows         float64
-	Eliminations       float64
-	SoloKills          float64
-	HealingDealt       float64
-	EnvironmentalKills float64
-	OffensiveAssists   float64
-	UltsUsed           float64
+	Hero               string  `json:"hero"`
+	TimeSpentInSeconds int     `json:"timeSpentInSeconds"`
+	DamageDealt        float64 `json:"damageDealt"`
+	DamageTaken        float64 `json:"damageTaken"`
+	Deaths             float64 `json:"deaths"`
+	FinalBlows         float64 `json:"finalBlows"`
+	Eliminations       float64 `json:"eliminations"`
+	SoloKills          float64 `json:"soloKills"`
+	HealingDealt       float64 `json:"healingDealt"`
+	EnvironmentalKills float64 `json:"environmentalKills"`
+	OffensiveAssists   float64 `json:"offensiveAssists"`
+	UltsUsed           float64 `json:"ultsUsed"`
 }
 
 type Map struct {
@@ -20,36 +22,328 @@ type Map struct {
 	Winner             string
 	TotalTimeInSeconds int
 	MatchID            int
+	LogHash            string
+	Timeline           MapTimeline
+}
+
+type Season struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Current bool   `json:"current"`
+}
+
+type Division struct {
+	ID           int      `json:"id"`
+	Name         string   `json:"name"`
+	ColorHexcode string   `json:"colorHexcode"`
+	Season       int      `json:"season"`
+	Teams        []string `json:"teams,omitempty"`
+}
+
+type Pot struct {
+	Number int      `json:"pot"`
+	Teams  []string `json:"teams"`
+}
+
+type GroupDraw struct {
+	Seed      int64      `json:"seed"`
+	Season    int        `json:"season"`
+	Divisions []Division `json:"divisions"`
+}
+
+type Standing struct {
+	Rank              int    `json:"rank"`
+	Team              string `json:"team"`
+	MatchesPlayed     int    `json:"matchesPlayed"`
+	MatchWins         int    `json:"matchWins"`
+	MatchLosses       int    `json:"matchLosses"`
+	MatchDraws        int    `json:"matchDraws"`
+	MapWins           int    `json:"mapWins"`
+	MapLosses         int    `json:"mapLosses"`
+	MapDraws          int    `json:"mapDraws"`
+	MapDifferential   int    `json:"mapDifferential"`
+	RoundDifferential int    `json:"roundDifferential"`
+}
+
+type Standings struct {
+	Division    Division   `json:"division"`
+	Tiebreakers []string   `json:"tiebreakers"`
+	Standings   []Standing `json:"standings"`
+}
+
+// Series is a match's result so far. BestOf is 0 for matches created before
+// the format was recorded. A decided series without a winner is a draw.
+type Series struct {
+	MatchID     int    `json:"matchID"`
+	Season      int    `json:"season"`
+	Team1       string `json:"team1"`
+	Team2       string `json:"team2"`
+	GrandFinals bool   `json:"grandfinals"`
+	BestOf      int    `json:"bestOf"`
+	Team1Score  int    `json:"team1Score"`
+	Team2Score  int    `json:"team2Score"`
+	MapsPlayed  int    `json:"mapsPlayed"`
+	Decided     bool   `json:"decided"`
+	Winner      string `json:"winner"`
+	// ScheduledAt is when the match starts, PlayedAt when its last map was uploaded
+	ScheduledAt *time.Time `json:"scheduledAt,omitempty"`
+	PlayedAt    *time.Time `json:"playedAt,omitempty"`
+}
+
+type Bracket struct {
+	ID          int           `json:"id"`
+	Name        string        `json:"name"`
+	Format      string        `json:"format"`
+	BestOf      int           `json:"bestOf"`
+	FinalBestOf int           `json:"finalBestOf"`
+	Season      int           `json:"season"`
+	Slots       []BracketSlot `json:"slots,omitempty"`
+}
+
+// BracketSlot is one match in a bracket. A nil team hasn't been decided yet
+// and an empty one is a bye.
+type BracketSlot struct {
+	ID           int     `json:"id"`
+	BracketID    int     `json:"bracketID"`
+	Side         string  `json:"side"`
+	Round        int     `json:"round"`
+	Position     int     `json:"position"`
+	Team1        *string `json:"team1"`
+	Team2        *string `json:"team2"`
+	BestOf       int     `json:"bestOf"`
+	MatchID      int     `json:"matchID,omitempty"`
+	Winner       *string `json:"winner"`
+	WinnerTo     int     `json:"winnerTo,omitempty"`
+	WinnerToTeam int     `json:"-"`
+	LoserTo      int     `json:"loserTo,omitempty"`
+	LoserToTeam  int     `json:"-"`
+}
+
+type MapSummary struct {
+	ID                int        `json:"id"`
+	MatchID           int        `json:"matchID"`
+	Name              string     `json:"name"`
+	Winner            string     `json:"winner"`
+	DurationInSeconds int        `json:"durationInSeconds"`
+	PlayedAt          *time.Time `json:"playedAt,omitempty"`
+}
+
+type UploadResult struct {
+	MapID     int    `json:"mapID"`
+	Duplicate bool   `json:"duplicate"`
+	Replaced  bool   `json:"replaced"`
+	Message   string `json:"message"`
+}
+
+// MapTimeline is the tick by tick development of a map. Seconds are map time,
+// so setup phases between rounds are not counted.
+type MapTimeline struct {
+	MapID   int              `json:"mapID"`
+	Rounds  []Round          `json:"rounds"`
+	Players []PlayerTimeline `json:"players"`
+}
+
+// Round is a stretch of live play between two setup phases.
+type Round struct {
+	Number       int `json:"number"`
+	StartSeconds int `json:"startSeconds"`
+	EndSeconds   int `json:"endSeconds"`
+	SetupSeconds int `json:"setupSeconds"`
+}
+
+type PlayerTimeline struct {
+	Player    string          `json:"player"`
+	Points    []TimelinePoint `json:"points"`
+	HeroSwaps []HeroSwap      `json:"heroSwaps"`
+}
+
+// TimelinePoint holds a player's cumulative stats at one tick.
+type TimelinePoint struct {
+	Seconds            int     `json:"seconds"`
+	Round              int     `json:"round"`
+	Hero               string  `json:"hero"`
+	DamageDealt        float64 `json:"damageDealt"`
+	DamageTaken        float64 `json:"damageTaken"`
+	Deaths             float64 `json:"deaths"`
+	FinalBlows         float64 `json:"finalBlows"`
+	Eliminations       float64 `json:"eliminations"`
+	SoloKills          float64 `json:"soloKills"`
+	HealingDealt       float64 `json:"healingDealt"`
+	EnvironmentalKills float64 `json:"environmentalKills"`
+	OffensiveAssists   float64 `json:"offensiveAssists"`
+	UltsUsed           float64 `json:"ultsUsed"`
+}
+
+type HeroSwap struct {
+	Seconds int    `json:"seconds"`
+	Round   int    `json:"round"`
+	From    string `json:"from"`
+	To      string `json:"to"`
 }
 
 type PlayerStats struct {
-	Name               string
-	Team               string
-	DurationInSeconds  int
-	DamageDealt        float64
-	DamageTaken        float64
-	Deaths             float64
-	FinalBlows         float64
-	Eliminations       float64
-	SoloKills          float64
-	HealingDealt       float64
-	EnvironmentalKills float64
-	OffensiveAssists   float64
-	UltsUsed           float64
-	Heroes             []HeroStats
+	Name               string             `json:"name"`
+	Team               string             `json:"team"`
+	Hero               string             `json:"hero,omitempty"`
+	Role               string             `json:"role,omitempty"`
+	DurationInSeconds  int                `json:"durationInSeconds"`
+	DamageDealt        float64            `json:"damageDealt"`
+	DamageTaken        float64            `json:"damageTaken"`
+	Deaths             float64            `json:"deaths"`
+	FinalBlows         float64            `json:"finalBlows"`
+	Eliminations       float64            `json:"eliminations"`
+	SoloKills          float64            `json:"soloKills"`
+	HealingDealt       float64            `json:"healingDealt"`
+	EnvironmentalKills float64            `json:"environmentalKills"`
+	OffensiveAssists   float64            `json:"offensiveAssists"`
+	UltsUsed           float64            `json:"ultsUsed"`
+	Heroes             []HeroStats        `json:"heroes,omitempty"`
+	Per10              StatsP10           `json:"per10"`
+	Ranks              []StatRank         `json:"ranks,omitempty"`
+	Stints             []RosterMembership `json:"stints,omitempty"`
+}
+
+// StatsP10 holds the ten tracked stats normalised to 10 minutes of playtime.
+type StatsP10 struct {
+	DamageDealt        float64 `json:"damageDealt"`
+	DamageTaken        float64 `json:"damageTaken"`
+	Deaths             float64 `json:"deaths"`
+	FinalBlows         float64 `json:"finalBlows"`
+	Eliminations       float64 `json:"eliminations"`
+	SoloKills          float64 `json:"soloKills"`
+	HealingDealt       float64 `json:"healingDealt"`
+	EnvironmentalKills float64 `json:"environmentalKills"`
+	OffensiveAssists   float64 `json:"offensiveAssists"`
+	UltsUsed           float64 `json:"ultsUsed"`
+}
+
+// StatRank is a player's position on one stat leaderboard. Players below the
+// playtime or map thresholds are unranked with Rank 0.
+type StatRank struct {
+	Stat     string `json:"stat"`
+	Rank     int    `json:"rank"`
+	OutOf    int    `json:"outOf"`
+	Unranked bool   `json:"unranked"`
+}
+
+// LeaderboardConfig is the "leaderboards" section of config.json. Thresholds
+// are keyed by scope, "overall", "hero" or "role", and directions by stat, either
+// "ascending" or "descending". Leaderboards are rebuilt for everyone on the next
+// start or update after it changes.
+type LeaderboardConfig struct {
+	MinPlaytimeSeconds map[string]int    `json:"minPlaytimeSeconds"`
+	MinMaps            map[string]int    `json:"minMaps"`
+	StatDirections     map[string]string `json:"statDirections"`
+}
+
+// PlayerProfile is who a player is, as opposed to their stats. ID stays the
+// same when other names are merged into the player.
+type PlayerProfile struct {
+	ID        int           `json:"id"`
+	Name      string        `json:"name"`
+	Team      string        `json:"team"`
+	DiscordID string        `json:"discordID,omitempty"`
+	Aliases   []PlayerAlias `json:"aliases"`
+}
+
+// PlayerAlias is another in-game name or a BattleTag of a player.
+type PlayerAlias struct {
+	Alias string `json:"alias"`
+	Kind  string `json:"kind"`
+}
+
+// Leaderboard ranks players by a stat per 10 minutes. Hero is empty for the
+// leaderboard over all heroes and Season 0 for the one over all seasons.
+type Leaderboard struct {
+	Stat       string             `json:"stat"`
+	Hero       string             `json:"hero,omitempty"`
+	Role       string             `json:"role,omitempty"`
+	Season     int                `json:"season,omitempty"`
+	Ascending  bool               `json:"ascending"`
+	ComputedAt *time.Time         `json:"computedAt"`
+	Entries    []LeaderboardEntry `json:"entries"`
+}
+
+// LeaderboardEntry is a player on a leaderboard. Players below the playtime or
+// map thresholds are unranked with Rank 0.
+type LeaderboardEntry struct {
+	Rank     int     `json:"rank"`
+	Player   string  `json:"player"`
+	Value    float64 `json:"value"`
+	Unranked bool    `json:"unranked"`
+}
+
+type PlayerComparison struct {
+	Players    [2]PlayerStats `json:"players"`
+	Difference StatsP10       `json:"difference"`
+}
+
+// RosterMembership is a stretch of consecutive maps a player played for one
+// team in one season. LeftAt is when the player first played for another team
+// and nil while they haven't.
+type RosterMembership struct {
+	Player            string     `json:"player,omitempty"`
+	Team              string     `json:"team,omitempty"`
+	Season            int        `json:"season"`
+	JoinedAt          *time.Time `json:"joinedAt"`
+	LeftAt            *time.Time `json:"leftAt"`
+	Maps              int        `json:"maps"`
+	DurationInSeconds int        `json:"durationInSeconds,omitempty"`
+	Per10             *StatsP10  `json:"per10,omitempty"`
+}
+
+type Roster struct {
+	Team    string             `json:"team"`
+	Season  int                `json:"season"`
+	Players []RosterMembership `json:"players"`
+}
+
+// Team is a team as it's presented. Name is the lowercase name the team is
+// stored and looked up by.
+type Team struct {
+	Name          string `json:"name"`
+	DisplayName   string `json:"displayName"`
+	Tag           string `json:"tag,omitempty"`
+	LogoURL       string `json:"logoURL,omitempty"`
+	SeasonsPlayed int    `json:"seasonsPlayed"`
 }
 
 type TeamStats struct {
-	Team string
-	MapWins int
-	MapLosses int
-	MapDraws int
-	Maps []MapStats
+	Team          string     `json:"team"`
+	DisplayName   string     `json:"displayName"`
+	Tag           string     `json:"tag,omitempty"`
+	LogoURL       string     `json:"logoURL,omitempty"`
+	Season        int        `json:"season,omitempty"`
+	SeasonsPlayed int        `json:"seasonsPlayed"`
+	Division      *Division  `json:"division,omitempty"`
+	MatchWins     int        `json:"matchWins"`
+	MatchLosses   int        `json:"matchLosses"`
+	MatchDraws    int        `json:"matchDraws"`
+	MapWins       int        `json:"mapWins"`
+	MapLosses     int        `json:"mapLosses"`
+	MapDraws      int        `json:"mapDraws"`
+	Maps          []MapStats `json:"maps"`
+	Series        []Series   `json:"series"`
 }
 
 type MapStats struct {
-	Name string
-	Wins int
-	Losses int
-	Draws int
-}
\ No newline at end of file
+	Name   string `json:"name"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+	Draws  int    `json:"draws"`
+}
+
+func (stats StatsP10) asArray() [10]float64 {
+	return [10]float64{
+		stats.DamageDealt,
+		stats.DamageTaken,
+		stats.Deaths,
+		stats.FinalBlows,
+		stats.Eliminations,
+		stats.SoloKills,
+		stats.HealingDealt,
+		stats.EnvironmentalKills,
+		stats.OffensiveAssists,
+		stats.UltsUsed,
+	}
+}